@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/Marattttt/portfolio/frontend/internal/handlers/templates"
+	"github.com/Marattttt/portfolio/frontend/internal/runners"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// How long a binary can be downloaded, should not be shorter than ARTIFACT_TTL of the runners
+	downloadTTL = 10 * time.Minute
+	// Binaries kept at once, the oldest one is dropped to make room for a new one
+	maxDownloads = 64
+)
+
+// Binaries kept by the runners, that built them, the page downloads them by an id, which does not reveal the runner
+type downloads = expiring[runners.Artifact]
+
+func newDownloads() *downloads {
+	return newExpiring[runners.Artifact](downloadTTL, maxDownloads)
+}
+
+// Build go code for the chosen platform, the binary is kept by the runner and downloaded with HandleDownload
+func HandleArtifact(gorunner GoRunner, downloads *downloads) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Artifact request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Builds for download are only supported for go")
+		}
+
+		resp, err := gorunner.Artifact(c.Request().Context(), req.Code, req.Platform)
+		if err != nil {
+			return fmt.Errorf("building go code for download: %w", err)
+		}
+
+		if resp.Artifact == nil {
+			writeView(c, templates.Diagnostics(resp.Diagnostics))
+			return nil
+		}
+
+		writeView(c, templates.ArtifactLink(
+			"/download/"+downloads.add(*resp.Artifact),
+			resp.Artifact.Name,
+			resp.Artifact.Size,
+			resp.Artifact.Expires,
+		))
+
+		return nil
+	}
+}
+
+// Download a binary from the runner, that built it, which forgets it once it expires
+func HandleDownload(gorunner GoRunner, downloads *downloads) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		stored, ok := downloads.get(c.Param("id"))
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		artifact, binary, err := gorunner.Download(c.Request().Context(), stored)
+		if errors.Is(err, runners.ErrRejected) {
+			return echo.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("downloading artifact: %w", err)
+		}
+
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name})
+		c.Response().Header().Set(echo.HeaderContentDisposition, disposition)
+
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, binary)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Values kept under random ids for a limited time, e.g. between a request and the one, that the page makes after it
+type expiring[T any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	items map[string]expiringItem[T]
+}
+
+type expiringItem[T any] struct {
+	value   T
+	created time.Time
+}
+
+// Values are dropped after ttl, or once there are max of them, the oldest one is dropped to make room for a new one
+//
+// There is no limit on the amount of values, when max is 0
+func newExpiring[T any](ttl time.Duration, max int) *expiring[T] {
+	return &expiring[T]{ttl: ttl, max: max, items: make(map[string]expiringItem[T])}
+}
+
+// Store a value and return its id
+func (e *expiring[T]) add(value T) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var oldest string
+	for id, item := range e.items {
+		if time.Since(item.created) > e.ttl {
+			delete(e.items, id)
+			continue
+		}
+		if oldest == "" || item.created.Before(e.items[oldest].created) {
+			oldest = id
+		}
+	}
+	if e.max > 0 && len(e.items) >= e.max {
+		delete(e.items, oldest)
+	}
+
+	id := uuid.NewString()
+	e.items[id] = expiringItem[T]{value: value, created: time.Now()}
+
+	return id
+}
+
+// Get a value, it can be read any amount of times until it expires
+func (e *expiring[T]) get(id string) (T, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.lookup(id)
+}
+
+// Get a value and remove it, so that it is only used once
+func (e *expiring[T]) take(id string) (T, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	value, ok := e.lookup(id)
+	delete(e.items, id)
+
+	return value, ok
+}
+
+// Must be called with mu held
+func (e *expiring[T]) lookup(id string) (T, bool) {
+	item, ok := e.items[id]
+	if !ok || time.Since(item.created) > e.ttl {
+		var zero T
+		return zero, false
+	}
+
+	return item.value, true
+}
@@ -12,11 +12,17 @@ import (
 )
 
 type runRequest struct {
-	Code string `schema:"code,required"`
-	Lang string `schema:"lang,required"`
+	Code  string `schema:"code,required"`
+	Lang  string `schema:"lang,required"`
+	Stdin string `schema:"stdin"`
+	// Only used by benchmarks
+	Benchtime string `schema:"benchtime"`
+	// Only used by builds for download
+	Platform string `schema:"platform"`
 }
 
-func HandleRun(gorunner GoRunner, jsrunner JsRunner) func(c echo.Context) error {
+// Run code, go runs are only submitted, and their output is streamed by HandleRunStream
+func HandleRun(jsrunner JsRunner, runs *pendingRuns) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		urlEncoded, err := io.ReadAll(c.Request().Body)
 		defer c.Request().Body.Close()
@@ -34,13 +40,11 @@ func HandleRun(gorunner GoRunner, jsrunner JsRunner) func(c echo.Context) error
 
 		switch req.Lang {
 		case "golang":
-			resp, err = gorunner.Run(c.Request().Context(), req.Code)
-			if err != nil {
-				return fmt.Errorf("running go code: %w", err)
-			}
+			writeView(c, templates.StreamOutput("/run/stream/"+runs.add(req)))
+			return nil
 
 		case "javascript":
-			resp, err = jsrunner.Run(c.Request().Context(), req.Code)
+			resp, err = jsrunner.Run(c.Request().Context(), req.Code, req.Stdin)
 			if err != nil {
 				return fmt.Errorf("running js code: %w", err)
 			}
@@ -58,12 +62,196 @@ func HandleRun(gorunner GoRunner, jsrunner JsRunner) func(c echo.Context) error
 				string(resp.Sstderr),
 				resp.ExitCode,
 				resp.ExecutionTime),
+			templates.Diagnostics(resp.Diagnostics),
+		)
+
+		return nil
+	}
+}
+
+// Run tests of go code, which is split into files with -- name -- lines
+func HandleTest(gorunner GoRunner) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Test request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Tests are only supported for go")
+		}
+
+		resp, err := gorunner.Test(c.Request().Context(), req.Code)
+		if err != nil {
+			return fmt.Errorf("testing go code: %w", err)
+		}
+
+		// Stdout is the raw go test -json stream, the report shows the same in a readable form
+		writeView(
+			c,
+			templates.RunResult(
+				"",
+				string(resp.Sstderr),
+				resp.ExitCode,
+				resp.ExecutionTime),
+			templates.TestReport(resp.Tests),
+			templates.Diagnostics(resp.Diagnostics),
+		)
+
+		return nil
+	}
+}
+
+// Run go test for go code, which is split into files with -- name -- lines, showing which lines the tests ran
+func HandleCover(gorunner GoRunner) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Coverage request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Coverage is only supported for go")
+		}
+
+		resp, err := gorunner.Cover(c.Request().Context(), req.Code)
+		if err != nil {
+			return fmt.Errorf("measuring coverage of go code: %w", err)
+		}
+
+		writeView(
+			c,
+			templates.RunResult(
+				"",
+				string(resp.Sstderr),
+				resp.ExitCode,
+				resp.ExecutionTime),
+			templates.TestReport(resp.Tests),
+			templates.Coverage(runners.SplitFiles(req.Code), resp.Coverage),
+			templates.Diagnostics(resp.Diagnostics),
 		)
 
 		return nil
 	}
 }
 
+// Run benchmarks of go code, which is split into files with -- name -- lines
+func HandleBench(gorunner GoRunner) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Bench request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Benchmarks are only supported for go")
+		}
+
+		resp, err := gorunner.Bench(c.Request().Context(), req.Code, req.Benchtime)
+		if err != nil {
+			return fmt.Errorf("benchmarking go code: %w", err)
+		}
+
+		// Failed benchmarks are reported the same way as failed tests
+		writeView(
+			c,
+			templates.RunResult(
+				"",
+				string(resp.Sstderr),
+				resp.ExitCode,
+				resp.ExecutionTime),
+			templates.BenchTable(resp.Benchmarks),
+			templates.TestReport(resp.Tests),
+			templates.Diagnostics(resp.Diagnostics),
+		)
+
+		return nil
+	}
+}
+
+// Check go code with go vet, gofmt and the import policy without running it
+func HandleCheck(gorunner GoRunner) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Check request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Checks are only supported for go")
+		}
+
+		diagnostics, err := gorunner.Analyze(c.Request().Context(), req.Code)
+		if err != nil {
+			return fmt.Errorf("analyzing go code: %w", err)
+		}
+
+		writeView(c, templates.CheckResult(diagnostics))
+
+		return nil
+	}
+}
+
+// Format go code with gofmt, replacing the code in the editor
+//
+// Syntax errors are shown in the output, and the code is kept as is then
+func HandleFormat(gorunner GoRunner) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Format request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Formatting is only supported for go")
+		}
+
+		code, diagnostics, err := gorunner.Format(c.Request().Context(), req.Code)
+		if err != nil {
+			return fmt.Errorf("formatting go code: %w", err)
+		}
+
+		writeView(c, templates.CodeInput(code), templates.FormatResult(diagnostics))
+
+		return nil
+	}
+}
+
 func (r *runRequest) fillFromUrlEncoded(urlEncoded string) error {
 	values, err := url.ParseQuery(urlEncoded)
 	if err != nil {
@@ -83,6 +271,13 @@ func (r *runRequest) fillFromUrlEncoded(urlEncoded string) error {
 
 	r.Lang = lang
 
+	// Optional, programs read an empty stdin without it
+	r.Stdin = values.Get("stdin")
+	// Optional, the runner picks a default
+	r.Benchtime = values.Get("benchtime")
+	// Optional, the runner rejects builds for download without it
+	r.Platform = values.Get("platform")
+
 	return nil
 }
 func HandleIndex() func(c echo.Context) error {
@@ -93,7 +288,10 @@ func HandleIndex() func(c echo.Context) error {
 	}
 }
 
-func writeView(c echo.Context, tpl templ.Component) {
+// Render components one after another
+func writeView(c echo.Context, tpls ...templ.Component) {
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
-	tpl.Render(c.Request().Context(), c.Response().Writer)
+	for _, tpl := range tpls {
+		tpl.Render(c.Request().Context(), c.Response().Writer)
+	}
 }
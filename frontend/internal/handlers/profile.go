@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/Marattttt/portfolio/frontend/internal/handlers/templates"
+	"github.com/Marattttt/portfolio/frontend/internal/runners"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// How long raw profiles of a run can be downloaded
+	profileTTL = 10 * time.Minute
+	// Runs kept at once, the oldest one is dropped to make room for a new one
+	maxProfiles = 16
+)
+
+// Raw profiles of runs, that wait to be downloaded
+type runProfiles = expiring[runners.ProfileReport]
+
+func newRunProfiles() *runProfiles {
+	return newExpiring[runners.ProfileReport](profileTTL, maxProfiles)
+}
+
+// Run go code, or its benchmarks, with cpu and heap profiling, showing the functions, that cost the most
+//
+// Raw profiles are served by HandleProfileFile
+func HandleProfile(gorunner GoRunner, profiles *runProfiles, bench bool) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Profile request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Profiling is only supported for go")
+		}
+
+		var resp *runners.RunResult
+		if bench {
+			resp, err = gorunner.ProfileBench(c.Request().Context(), req.Code, req.Benchtime)
+		} else {
+			resp, err = gorunner.Profile(c.Request().Context(), req.Code, req.Stdin)
+		}
+		if err != nil {
+			return fmt.Errorf("profiling go code: %w", err)
+		}
+
+		// Stdout of benchmarks is the raw go test -json stream, the tables show the same in a readable form
+		stdout := string(resp.Sstdout)
+		if bench {
+			stdout = ""
+		}
+
+		url := ""
+		if resp.Profile != nil {
+			url = "/profile/" + profiles.add(*resp.Profile)
+		}
+
+		writeView(
+			c,
+			templates.RunResult(
+				stdout,
+				string(resp.Sstderr),
+				resp.ExitCode,
+				resp.ExecutionTime),
+			templates.BenchTable(resp.Benchmarks),
+			templates.TestReport(resp.Tests),
+			templates.ProfileTables(url, resp.Profile),
+			templates.Diagnostics(resp.Diagnostics),
+		)
+
+		return nil
+	}
+}
+
+// Serve a raw profile of a run, either cpu.pprof or heap.pprof
+func HandleProfileFile(profiles *runProfiles) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		report, ok := profiles.get(c.Param("id"))
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		var profile *runners.Profile
+		switch c.Param("file") {
+		case "cpu.pprof":
+			profile = report.CPU
+		case "heap.pprof":
+			profile = report.Heap
+		}
+		if profile == nil {
+			return echo.ErrNotFound
+		}
+
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": c.Param("file")})
+		c.Response().Header().Set(echo.HeaderContentDisposition, disposition)
+
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, profile.Raw)
+	}
+}
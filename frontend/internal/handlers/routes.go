@@ -9,16 +9,51 @@ import (
 )
 
 type GoRunner interface {
-	Run(context.Context, string) (*runners.RunResult, error)
+	Stream(ctx context.Context, code string, stdin string) <-chan runners.RunEvent
+	Session(ctx context.Context, code string, stdin string) (*runners.Session, error)
+	Test(ctx context.Context, code string) (*runners.RunResult, error)
+	Cover(ctx context.Context, code string) (*runners.RunResult, error)
+	Bench(ctx context.Context, code string, benchtime string) (*runners.RunResult, error)
+	Analyze(ctx context.Context, code string) ([]runners.Diagnostic, error)
+	Format(ctx context.Context, code string) (string, []runners.Diagnostic, error)
+	Wasm(ctx context.Context, code string) (*runners.RunResult, error)
+	Artifact(ctx context.Context, code string, platform string) (*runners.RunResult, error)
+	Download(ctx context.Context, artifact runners.Artifact) (*runners.Artifact, []byte, error)
+	Profile(ctx context.Context, code string, stdin string) (*runners.RunResult, error)
+	ProfileBench(ctx context.Context, code string, benchtime string) (*runners.RunResult, error)
 }
 
 type JsRunner interface {
-	Run(context.Context, string) (*runners.RunResult, error)
+	Run(ctx context.Context, code string, stdin string) (*runners.RunResult, error)
+	Session(ctx context.Context, code string, stdin string) (*runners.Session, error)
 }
 
 func SetupRoutes(e *echo.Echo, gorunner GoRunner, jsrunner JsRunner) {
 	e.Add("GET", "/", HandleIndex())
-	e.Add("POST", "/run", HandleRun(gorunner, jsrunner))
+	runs := newPendingRuns()
+
+	e.Add("POST", "/run", HandleRun(jsrunner, runs))
+	e.Add("GET", "/run/stream/:id", HandleRunStream(gorunner, runs))
+	e.Add("POST", "/session", HandleSession(runs))
+	e.Add("GET", "/session/:id", HandleSessionSocket(gorunner, jsrunner, runs))
+	e.Add("POST", "/test", HandleTest(gorunner))
+	e.Add("POST", "/cover", HandleCover(gorunner))
+	e.Add("POST", "/bench", HandleBench(gorunner))
+	e.Add("POST", "/check", HandleCheck(gorunner))
+	e.Add("POST", "/format", HandleFormat(gorunner))
+
+	artifacts := newWasmArtifacts()
+	e.Add("POST", "/wasm", HandleWasm(gorunner, artifacts))
+	e.Add("GET", "/wasm/:id/:file", HandleWasmFile(artifacts))
+
+	downloads := newDownloads()
+	e.Add("POST", "/artifact", HandleArtifact(gorunner, downloads))
+	e.Add("GET", "/download/:id", HandleDownload(gorunner, downloads))
+
+	profiles := newRunProfiles()
+	e.Add("POST", "/profile", HandleProfile(gorunner, profiles, false))
+	e.Add("POST", "/profile/bench", HandleProfile(gorunner, profiles, true))
+	e.Add("GET", "/profile/:id/:file", HandleProfileFile(profiles))
 
 	e.StaticFS("/static", static.Get())
 }
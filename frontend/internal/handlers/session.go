@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Marattttt/portfolio/frontend/internal/handlers/templates"
+	"github.com/Marattttt/portfolio/frontend/internal/runners"
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// A message from the terminal, sent by the ws extension of htmx with values of a form
+type terminalMessage struct {
+	// A line of input, written to stdin with a trailing newline
+	Input string `json:"input"`
+	// Set by the form, that closes stdin
+	EOF string `json:"eof"`
+}
+
+// Submit code for an interactive session, which starts once the terminal connects to HandleSessionSocket
+func HandleSession(runs *pendingRuns) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" && req.Lang != "javascript" {
+			c.Logger().Errorf("Invalid session request language %s", req.Lang)
+			return fmt.Errorf("Invalid request")
+		}
+
+		id := runs.add(req)
+		writeView(c, templates.Terminal(id, "/session/"+id))
+
+		return nil
+	}
+}
+
+// Run a submitted session, exchanging its input and output with the terminal over a websocket
+//
+// Output is sent as it is printed, followed by the result, after which the connection is closed
+func HandleSessionSocket(gorunner GoRunner, jsrunner JsRunner, runs *pendingRuns) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		req, ok := runs.take(id)
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			ctx, cancel := context.WithCancel(c.Request().Context())
+			defer cancel()
+
+			term := terminal{ws: ws, ctx: ctx}
+
+			var (
+				session *runners.Session
+				err     error
+			)
+			if req.Lang == "golang" {
+				session, err = gorunner.Session(ctx, req.Code, req.Stdin)
+			} else {
+				session, err = jsrunner.Session(ctx, req.Code, req.Stdin)
+			}
+			if err != nil {
+				c.Logger().Errorf("Starting a session: %s", err)
+				term.write(templates.TerminalError(id, err.Error()))
+				return
+			}
+			defer session.Close()
+
+			go func() {
+				// The page is gone, once it cannot be read from
+				defer cancel()
+
+				for {
+					var msg terminalMessage
+					if err := websocket.JSON.Receive(ws, &msg); err != nil {
+						return
+					}
+
+					var err error
+					if len(msg.EOF) > 0 {
+						err = session.CloseInput()
+					} else {
+						err = session.Write(msg.Input + "\n")
+						if err == nil {
+							err = term.write(templates.TerminalInput(id, msg.Input+"\n"))
+						}
+					}
+					if err != nil {
+						c.Logger().Errorf("Writing session input: %s", err)
+						return
+					}
+				}
+			}()
+
+			for ev := range session.Events {
+				var err error
+
+				switch {
+				case ev.Chunk != nil:
+					err = term.write(templates.TerminalOutput(id, ev.Chunk.Stream, string(ev.Chunk.Data)))
+				case ev.Result != nil:
+					err = term.write(templates.TerminalResult(
+						id,
+						ev.Result.ExitCode,
+						ev.Result.ExecutionTime,
+						ev.Result.Diagnostics,
+					))
+				default:
+					c.Logger().Errorf("Running a session: %s", ev.Err)
+					err = term.write(templates.TerminalError(id, ev.Err.Error()))
+				}
+
+				if err != nil {
+					c.Logger().Errorf("Writing session output: %s", err)
+					return
+				}
+			}
+		}).ServeHTTP(c.Response(), c.Request())
+
+		return nil
+	}
+}
+
+// Websocket of a terminal, which swaps received components into the page out of band
+type terminal struct {
+	ctx context.Context
+
+	// Output and echoed input are written concurrently
+	mu sync.Mutex
+	ws *websocket.Conn
+}
+
+// Render components and send them as a single message
+func (t *terminal) write(tpls ...templ.Component) error {
+	var rendered bytes.Buffer
+	for _, tpl := range tpls {
+		if err := tpl.Render(t.ctx, &rendered); err != nil {
+			return fmt.Errorf("rendering: %w", err)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return websocket.Message.Send(t.ws, rendered.String())
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Marattttt/portfolio/frontend/internal/handlers/templates"
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+)
+
+// How long a submitted run waits for the page to connect to its output
+const pendingRunTTL = time.Minute
+
+// Runs, that were submitted and wait for the page to connect to their output, a run is only started once
+type pendingRuns = expiring[runRequest]
+
+func newPendingRuns() *pendingRuns {
+	return newExpiring[runRequest](pendingRunTTL, 0)
+}
+
+// Run submitted go code, sending its output as server-sent events
+//
+// Output is sent in output events while the program runs, followed by a single result event
+func HandleRunStream(gorunner GoRunner, runs *pendingRuns) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		req, ok := runs.take(c.Param("id"))
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		resp := c.Response()
+		resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+		resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+		resp.WriteHeader(http.StatusOK)
+
+		for ev := range gorunner.Stream(c.Request().Context(), req.Code, req.Stdin) {
+			var err error
+
+			switch {
+			case ev.Chunk != nil:
+				err = writeEvent(c, "output", templates.OutputChunk(ev.Chunk.Stream, string(ev.Chunk.Data)))
+			case ev.Result != nil:
+				err = writeEvent(
+					c,
+					"result",
+					templates.RunResult(
+						"",
+						"",
+						ev.Result.ExitCode,
+						ev.Result.ExecutionTime),
+					templates.Diagnostics(ev.Result.Diagnostics),
+				)
+			default:
+				c.Logger().Errorf("Streaming go run: %s", ev.Err)
+				err = writeEvent(c, "result", templates.StreamError(ev.Err.Error()))
+			}
+
+			if err != nil {
+				return fmt.Errorf("writing event: %w", err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// Write rendered components as a single server-sent event and flush it
+func writeEvent(c echo.Context, name string, tpls ...templ.Component) error {
+	var rendered bytes.Buffer
+	for _, tpl := range tpls {
+		if err := tpl.Render(c.Request().Context(), &rendered); err != nil {
+			return fmt.Errorf("rendering: %w", err)
+		}
+	}
+
+	var event strings.Builder
+	event.WriteString("event: " + name + "\n")
+	// Lines of data are joined back with newlines by the browser
+	for _, line := range strings.Split(rendered.String(), "\n") {
+		event.WriteString("data: " + line + "\n")
+	}
+	event.WriteString("\n")
+
+	if _, err := c.Response().Write([]byte(event.String())); err != nil {
+		return err
+	}
+	c.Response().Flush()
+
+	return nil
+}
@@ -26,11 +26,19 @@ func Editor() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<form hx-post=\"/run\" hx-target=\"#code-output\" hx-swap=\"innerHTML\"><textarea name=\"code\" class=\"\n\t\t\t\tw-full p-2 min-h-[20rem] \n\t\t\t\tbg-transparent border border-amber-100 rounded-md \n\t\t\t\toverflow-scroll resize-none\n\t\t\t\tfocus:border-2 hover:border-2\n\t\t\t\tfocus:ring-0 focus:outline-none\" rows=\"10\"></textarea><div class=\"flex text-xl y-fit mt-1 gap-1\"><div class=\"basis-1/4\">")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<form hx-post=\"/run\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = radioLikeBtn("python-radio", "lang", "python", "Python").Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = CodeInput("").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<textarea name=\"stdin\" placeholder=\"Input (stdin)\" class=\"\n\t\t\t\tw-full p-2 mt-1 min-h-[4rem] \n\t\t\t\tbg-transparent border border-amber-100 rounded-md \n\t\t\t\toverflow-scroll resize-none\n\t\t\t\tfocus:border-2 hover:border-2\n\t\t\t\tfocus:ring-0 focus:outline-none\" rows=\"3\"></textarea><input name=\"benchtime\" placeholder=\"Benchtime, e.g. 1s or 100x\" class=\"\n\t\t\t\tw-full p-2 mt-1\n\t\t\t\tbg-transparent border border-amber-100 rounded-md\n\t\t\t\tfocus:border-2 hover:border-2\n\t\t\t\tfocus:ring-0 focus:outline-none\"><div class=\"flex text-xl y-fit mt-1 gap-1\"><div class=\"basis-1/4\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = radioLikeBtn("javascript-radio", "lang", "javascript", "JavaScript").Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -42,7 +50,7 @@ func Editor() templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"basis-2/4\">")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -50,6 +58,86 @@ func Editor() templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/session\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Interactive").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/wasm\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Browser").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/test\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Test").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/cover\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Coverage").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/bench\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Bench").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/profile\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Profile").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/profile/bench\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Profile bench").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/check\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Check").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><div class=\"flex-1\" hx-post=\"/format\" hx-target=\"#code\" hx-swap=\"outerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Format").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div></div><div class=\"flex text-xl y-fit mt-1 gap-1\"><select name=\"platform\" class=\"basis-1/4 p-2 bg-transparent border border-amber-100 rounded-md\"><option value=\"linux/amd64\">Linux x86-64</option><option value=\"linux/arm64\">Linux ARM64</option><option value=\"darwin/amd64\">macOS Intel</option><option value=\"darwin/arm64\">macOS Apple silicon</option><option value=\"windows/amd64\">Windows x86-64</option></select><div class=\"flex-1\" hx-post=\"/artifact\" hx-target=\"#code-output\" hx-swap=\"innerHTML\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = Button("button", "Build for download").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div></div></form><div id=\"code-output\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Marattttt/portfolio/frontend/internal/handlers/templates"
+	"github.com/Marattttt/portfolio/frontend/internal/runners"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// How long the page can load a built program
+	wasmArtifactTTL = 5 * time.Minute
+	// Programs kept at once, the oldest one is dropped to make room for a new one
+	maxWasmArtifacts = 16
+)
+
+// Programs built for the browser, that wait for the page to load them
+type wasmArtifacts = expiring[runners.WasmArtifact]
+
+func newWasmArtifacts() *wasmArtifacts {
+	return newExpiring[runners.WasmArtifact](wasmArtifactTTL, maxWasmArtifacts)
+}
+
+// Build go code for the browser, the page loads the program from HandleWasmFile and runs it
+func HandleWasm(gorunner GoRunner, artifacts *wasmArtifacts) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		urlEncoded, err := io.ReadAll(c.Request().Body)
+		defer c.Request().Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+
+		var req runRequest
+		if err := req.fillFromUrlEncoded(string(urlEncoded)); err != nil {
+			return fmt.Errorf("parsing url encoded request: %w", err)
+		}
+
+		if req.Lang != "golang" {
+			c.Logger().Errorf("Wasm request for unsupported language %s", req.Lang)
+			return fmt.Errorf("Browser builds are only supported for go")
+		}
+
+		resp, err := gorunner.Wasm(c.Request().Context(), req.Code)
+		if err != nil {
+			return fmt.Errorf("building go code for wasm: %w", err)
+		}
+
+		if resp.Wasm == nil {
+			writeView(c, templates.Diagnostics(resp.Diagnostics))
+			return nil
+		}
+
+		writeView(c, templates.WasmRun("/wasm/"+artifacts.add(*resp.Wasm)))
+
+		return nil
+	}
+}
+
+// Serve a file of a built program, either main.wasm or wasm_exec.js
+func HandleWasmFile(artifacts *wasmArtifacts) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		artifact, ok := artifacts.get(c.Param("id"))
+		if !ok {
+			return echo.ErrNotFound
+		}
+
+		switch c.Param("file") {
+		case "main.wasm":
+			return c.Blob(http.StatusOK, "application/wasm", artifact.Binary)
+		case "wasm_exec.js":
+			return c.Blob(http.StatusOK, "text/javascript", artifact.WasmExec)
+		default:
+			return echo.ErrNotFound
+		}
+	}
+}
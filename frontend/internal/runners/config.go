@@ -1,5 +1,7 @@
 package runners
 
+import "time"
+
 type Config struct {
 	MQAddr string `env:"MQ_ADDR, default=localhost:5672"`
 	MqUser string `env:"MQ_USER, default=guest"`
@@ -10,4 +12,10 @@ type Config struct {
 
 	JsSendQ string `env:"JS_SENDQ, default=jsrunner"`
 	JsRespQ string `env:"JS_RESPQ, default=jsrunner-response"`
+
+	// Prefixes of queues with input of sessions, have to match the ones of the runners
+	GoSessionQ string `env:"GO_SESSIONQ, default=gorunner-session"`
+	JsSessionQ string `env:"JS_SESSIONQ, default=jsrunner-session"`
+	// How long to wait for a session to finish, should be longer than the session timeout of the runners
+	SessionTimeout time.Duration `env:"SESSION_TIMEOUT, default=6m"`
 }
@@ -0,0 +1,71 @@
+package runners
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// File name to put code into, when it does not start with a file marker
+const mainFile = "main.go"
+
+// A line like "-- util/util.go --"
+var fileMarkerRe = regexp.MustCompile(`^-- (\S+) --$`)
+
+// Split code from a single editor into files, the same way txtar archives do
+//
+// Every "-- name --" line starts a new file, and code before the first marker goes to main.go,
+// so code without any markers is a single main.go
+func SplitFiles(code string) map[string]string {
+	files := make(map[string]string)
+
+	name := mainFile
+	var content strings.Builder
+
+	flush := func() {
+		// Code before the first marker is usually just leftover whitespace
+		if name == mainFile && strings.TrimSpace(content.String()) == "" {
+			return
+		}
+		files[name] += content.String()
+	}
+
+	for _, line := range strings.SplitAfter(code, "\n") {
+		if match := fileMarkerRe.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			flush()
+			name = match[1]
+			content.Reset()
+			continue
+		}
+		content.WriteString(line)
+	}
+	flush()
+
+	return files
+}
+
+// Join files back into code for a single editor, reversing SplitFiles
+//
+// main.go goes first without a marker, other files follow it sorted by name
+func JoinFiles(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != mainFile {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var code strings.Builder
+	code.WriteString(files[mainFile])
+
+	for _, name := range names {
+		if code.Len() > 0 && !strings.HasSuffix(code.String(), "\n") {
+			code.WriteString("\n")
+		}
+		code.WriteString("-- " + name + " --\n")
+		code.WriteString(files[name])
+	}
+
+	return code.String()
+}
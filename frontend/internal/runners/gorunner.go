@@ -2,8 +2,11 @@ package runners
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
 
@@ -20,30 +23,248 @@ func NewGoRunner(conf Config, conn *amqp091.Connection) GoRunner {
 }
 
 type goRunReq struct {
-	Code string `json:"code"`
+	Op    string            `json:"op,omitempty"`
+	Files map[string]string `json:"files"`
+	Stdin string            `json:"stdin,omitempty"`
+	// Measure line coverage, only used by test runs
+	Cover bool `json:"cover,omitempty"`
+	// Only used by benchmark runs, empty for the default of the runner
+	Benchtime string `json:"benchtime,omitempty"`
+	// Profile benchmarks instead of the program, only used by profiled runs
+	ProfileBench bool `json:"profileBench,omitempty"`
+	// Publish output while the program runs
+	Stream bool `json:"stream,omitempty"`
+	// Id of an interactive session, only used by session runs
+	Session string `json:"session,omitempty"`
+	// GOOS/GOARCH pair, only used by builds for download
+	Platform string `json:"platform,omitempty"`
+	// Only used by downloads
+	Token string `json:"token,omitempty"`
 }
 type goRunResp struct {
-	Stdout   []byte        `json:"stdout"`
-	Stderr   []byte        `json:"stderr"`
-	ExitCode int           `json:"exitCode"`
-	TimeTook time.Duration `json:"timeTook"`
+	Compile *struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	} `json:"compile"`
+
+	Stdout     []byte          `json:"stdout"`
+	Stderr     []byte          `json:"stderr"`
+	ExitCode   int             `json:"exitCode"`
+	TimeTook   time.Duration   `json:"timeTook"`
+	Tests      *TestReport     `json:"tests"`
+	Coverage   *CoverageReport `json:"coverage"`
+	Benchmarks []Benchmark     `json:"benchmarks"`
+	Analysis   *struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	} `json:"analysis"`
+	Format *struct {
+		Files       map[string]string `json:"files"`
+		Diagnostics []Diagnostic      `json:"diagnostics"`
+	} `json:"format"`
+	Error string `json:"error"`
+
+	// Set on messages of a streamed run, that precede the final one
+	Chunk *OutputChunk `json:"chunk"`
+	// Amount of chunks before the final message of a streamed run
+	Streamed int `json:"streamed"`
+
+	// Set for wasm builds, that compiled
+	Wasm *WasmArtifact `json:"wasm"`
+	// Set for builds for download, that compiled, and for downloads
+	Artifact *Artifact `json:"artifact"`
+	// Only set for downloads
+	Binary []byte `json:"binary"`
+	// Queue of the runner, that keeps the binary, set along with Artifact for builds for download
+	DownloadQ string `json:"downloadQ"`
+
+	// Set for profiled runs, that wrote profiles
+	Profile *ProfileReport `json:"profile"`
+}
+
+// Run code, split into files with SplitFiles
+func (g GoRunner) Run(ctx context.Context, code string, stdin string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Files: SplitFiles(code), Stdin: stdin})
+}
+
+// Run code, split into files with SplitFiles, passing its output on while it runs
+//
+// The channel gets chunks in order, followed by the result or an error, and is closed afterwards
+func (g GoRunner) Stream(ctx context.Context, code string, stdin string) <-chan RunEvent {
+	events := make(chan RunEvent)
+
+	go func() {
+		defer close(events)
+
+		// TODO: Add timeout to configuration
+		ctx, cancel := context.WithTimeout(ctx, time.Second*20)
+		defer cancel()
+
+		streamEvents[goRunResp](ctx, g.conn, g.conf.GoSendQ, g.conf.GoRespQ, goRunReq{Files: SplitFiles(code), Stdin: stdin, Stream: true}, events)
+	}()
+
+	return events
+}
+
+// Start code, split into files with SplitFiles, as an interactive session, that reads input while it runs
+func (g GoRunner) Session(ctx context.Context, code string, stdin string) (*Session, error) {
+	id := uuid.NewString()
+	return startSession[goRunResp](
+		ctx,
+		g.conn,
+		g.conf.GoSendQ,
+		g.conf.GoRespQ,
+		g.conf.GoSessionQ+"."+id,
+		goRunReq{Op: "session", Session: id, Files: SplitFiles(code), Stdin: stdin},
+		g.conf.SessionTimeout,
+	)
+}
+
+// Run go test for code, split into files with SplitFiles
+func (g GoRunner) Test(ctx context.Context, code string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "test", Files: SplitFiles(code)})
+}
+
+// Run go test for code, split into files with SplitFiles, measuring which lines the tests ran
+//
+// Lines are in RunResult.Coverage, unless the tests did not build
+func (g GoRunner) Cover(ctx context.Context, code string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "test", Files: SplitFiles(code), Cover: true})
+}
+
+// Run benchmarks of code, split into files with SplitFiles, for benchtime, e.g. 1s or 100x
+func (g GoRunner) Bench(ctx context.Context, code string, benchtime string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "bench", Files: SplitFiles(code), Benchtime: benchtime})
+}
+
+// Build code, split into files with SplitFiles, for the browser, without running it
+//
+// The program is in RunResult.Wasm, unless the code did not compile
+func (g GoRunner) Wasm(ctx context.Context, code string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "wasm", Files: SplitFiles(code)})
+}
+
+// Build code, split into files with SplitFiles, for a GOOS/GOARCH pair, e.g. linux/amd64, without running it
+//
+// The runner keeps the binary, which is downloaded with Download using RunResult.Artifact, unless the code did not compile
+func (g GoRunner) Artifact(ctx context.Context, code string, platform string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "artifact", Files: SplitFiles(code), Platform: platform})
+}
+
+// Get a binary built with Artifact from the runner, that built it
+//
+// Unknown and expired tokens are an ErrRejected, as well as binaries of runners, that have stopped since
+func (g GoRunner) Download(ctx context.Context, artifact Artifact) (*Artifact, []byte, error) {
+	resp, err := g.requestQueue(ctx, artifact.Queue, runnerQueue, goRunReq{Op: "download", Token: artifact.Token})
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.NotFound {
+		return nil, nil, fmt.Errorf("%w: the runner, that built the binary, has stopped", ErrRejected)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Artifact == nil {
+		return nil, nil, fmt.Errorf("no artifact in response")
+	}
+
+	return resp.Artifact, resp.Binary, nil
+}
+
+// Run code, split into files with SplitFiles, with cpu and heap profiling
+//
+// Profiles are in RunResult.Profile, unless the program exited before writing them, e.g. with os.Exit
+func (g GoRunner) Profile(ctx context.Context, code string, stdin string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "profile", Files: SplitFiles(code), Stdin: stdin})
 }
 
-func (g GoRunner) Run(ctx context.Context, code string) (*RunResult, error) {
+// Run benchmarks of the package at the root of code, split into files with SplitFiles, with cpu and heap profiling
+func (g GoRunner) ProfileBench(ctx context.Context, code string, benchtime string) (*RunResult, error) {
+	return g.send(ctx, goRunReq{Op: "profile", Files: SplitFiles(code), Benchtime: benchtime, ProfileBench: true})
+}
+
+// Check code with go vet, gofmt and the import policy without running it
+func (g GoRunner) Analyze(ctx context.Context, code string) ([]Diagnostic, error) {
+	res, err := g.send(ctx, goRunReq{Op: "analyze", Files: SplitFiles(code)})
+	if err != nil {
+		return nil, err
+	}
+	return res.Diagnostics, nil
+}
+
+// Format code with gofmt, returning it unchanged along with syntax errors if it does not parse
+func (g GoRunner) Format(ctx context.Context, code string) (string, []Diagnostic, error) {
+	resp, err := g.request(ctx, goRunReq{Op: "format", Files: SplitFiles(code)})
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.Format == nil {
+		return "", nil, fmt.Errorf("no format result in response")
+	}
+
+	return JoinFiles(resp.Format.Files), resp.Format.Diagnostics, nil
+}
+
+func (g GoRunner) send(ctx context.Context, req goRunReq) (*RunResult, error) {
+	resp, err := g.request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.result(), nil
+}
+
+func (resp *goRunResp) chunk() *OutputChunk {
+	return resp.Chunk
+}
+
+func (resp *goRunResp) streamed() int {
+	return resp.Streamed
+}
+
+func (resp *goRunResp) final() (*RunResult, error) {
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, resp.Error)
+	}
+	return resp.result(), nil
+}
+
+func (resp *goRunResp) result() *RunResult {
+	res := &RunResult{Sstdout: resp.Stdout, Sstderr: resp.Stderr, ExitCode: resp.ExitCode, ExecutionTime: resp.TimeTook, Tests: resp.Tests, Coverage: resp.Coverage, Benchmarks: resp.Benchmarks, Wasm: resp.Wasm, Artifact: resp.Artifact, Profile: resp.Profile}
+	if resp.Compile != nil {
+		res.Diagnostics = resp.Compile.Diagnostics
+	}
+	if resp.Analysis != nil {
+		res.Diagnostics = resp.Analysis.Diagnostics
+	}
+	if resp.Artifact != nil {
+		res.Artifact.Queue = resp.DownloadQ
+	}
+
+	return res
+}
+
+func (g GoRunner) request(ctx context.Context, req goRunReq) (*goRunResp, error) {
+	return g.requestQueue(ctx, g.conf.GoSendQ, sharedQueue, req)
+}
+
+func (g GoRunner) requestQueue(ctx context.Context, sendq string, declare declareQueue, req goRunReq) (*goRunResp, error) {
 	// TODO: Add timeout to configuration
 	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
 	defer cancel()
 	resp, err := publishGetResponse[goRunResp](
 		ctx,
 		g.conn,
-		g.conf.GoSendQ,
+		sendq,
+		declare,
 		g.conf.GoRespQ,
-		goRunReq{Code: code},
+		req,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &RunResult{Sstdout: resp.Stdout, Sstderr: resp.Stderr, ExitCode: resp.ExitCode, ExecutionTime: resp.TimeTook}, nil
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, resp.Error)
+	}
+
+	return resp, nil
 }
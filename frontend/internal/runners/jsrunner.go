@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
 
@@ -21,7 +22,10 @@ func NewJsRunner(conf Config, conn *amqp091.Connection) JsRunner {
 }
 
 type jsRunReq struct {
-	Code string `json:"code"`
+	Code  string `json:"code"`
+	Stdin string `json:"stdin,omitempty"`
+	// Id of an interactive session, empty for a regular run
+	Session string `json:"session,omitempty"`
 }
 
 type jsRunResp struct {
@@ -29,9 +33,44 @@ type jsRunResp struct {
 	Stderr   []byte        `json:"stderr"`
 	ExitCode int           `json:"exitCode"`
 	TimeTook time.Duration `json:"timeTook"`
+	Error    string        `json:"error"`
+
+	// Set on messages of a session, that precede the final one
+	Chunk *OutputChunk `json:"chunk"`
+	// Amount of chunks before the final message of a session
+	Streamed int `json:"streamed"`
+}
+
+func (resp *jsRunResp) chunk() *OutputChunk {
+	return resp.Chunk
+}
+
+func (resp *jsRunResp) streamed() int {
+	return resp.Streamed
+}
+
+func (resp *jsRunResp) final() (*RunResult, error) {
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, resp.Error)
+	}
+	return &RunResult{Sstdout: resp.Stdout, Sstderr: resp.Stderr, ExitCode: resp.ExitCode, ExecutionTime: resp.TimeTook}, nil
 }
 
-func (g JsRunner) Run(ctx context.Context, code string) (*RunResult, error) {
+// Start code as an interactive session, that reads input while it runs
+func (g JsRunner) Session(ctx context.Context, code string, stdin string) (*Session, error) {
+	id := uuid.NewString()
+	return startSession[jsRunResp](
+		ctx,
+		g.conn,
+		g.conf.JsSendQ,
+		g.conf.JsRespQ,
+		g.conf.JsSessionQ+"."+id,
+		jsRunReq{Code: code, Stdin: stdin, Session: id},
+		g.conf.SessionTimeout,
+	)
+}
+
+func (g JsRunner) Run(ctx context.Context, code string, stdin string) (*RunResult, error) {
 	// TODO: Add timeout to configuration
 	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
 	defer cancel()
@@ -43,13 +82,18 @@ func (g JsRunner) Run(ctx context.Context, code string) (*RunResult, error) {
 		ctx,
 		g.conn,
 		g.conf.JsSendQ,
+		sharedQueue,
 		g.conf.JsRespQ,
-		jsRunReq{Code: code},
+		jsRunReq{Code: code, Stdin: stdin},
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, resp.Error)
+	}
+
 	return &RunResult{Sstdout: resp.Stdout, Sstderr: resp.Stderr, ExitCode: resp.ExitCode, ExecutionTime: resp.TimeTook}, nil
 }
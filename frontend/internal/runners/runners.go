@@ -3,6 +3,7 @@ package runners
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -11,34 +12,317 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// Returned (wrapped) when a runner answers a request with an error instead of a result
+var ErrRejected = errors.New("submission rejected")
+
 type RunResult struct {
 	Sstdout       []byte
 	Sstderr       []byte
 	ExitCode      int
 	ExecutionTime time.Duration
+	// Compiler messages, when the code could not be built
+	Diagnostics []Diagnostic
+	// Results of go test, only set for test runs
+	Tests *TestReport
+	// Lines, that tests ran, only set for test runs with coverage, that built
+	Coverage *CoverageReport
+	// Results of go test -bench, only set for benchmark runs
+	Benchmarks []Benchmark
+	// Program for the browser, only set for wasm builds, that compiled
+	Wasm *WasmArtifact
+	// Binary kept by the runner for download, only set for builds for download, that compiled
+	Artifact *Artifact
+	// Cpu and heap profiles, only set for profiled runs, that wrote them
+	Profile *ProfileReport
+}
+
+// A binary, that can be downloaded by its token until it expires
+type Artifact struct {
+	Token string `json:"token"`
+	// File name for the download
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Expires time.Time `json:"expires"`
+	// Queue of the runner, that keeps the binary, downloads are only answered by it
+	Queue string `json:"-"`
+}
+
+// A go program built with GOOS=js GOARCH=wasm, which runs in the browser
+type WasmArtifact struct {
+	Binary []byte `json:"binary"`
+	// wasm_exec.js of the toolchain, that built the binary
+	WasmExec []byte `json:"wasmExec"`
+}
+
+// A piece of output of a streamed run
+type OutputChunk struct {
+	// stdout or stderr
+	Stream string `json:"stream"`
+	// Order of the chunk among chunks of both outputs, starting from 0
+	Seq  int    `json:"seq"`
+	Data []byte `json:"data"`
+}
+
+// A message of a streamed run, only one of the fields is set
+type RunEvent struct {
+	Chunk *OutputChunk
+	// Always the last event of a finished run
+	Result *RunResult
+	// Always the last event of a run, that could not be finished
+	Err error
+}
+
+// Results of go test for every package
+type TestReport struct {
+	Packages []TestPackage `json:"packages"`
+	Passed   int           `json:"passed"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"`
+}
+
+type TestPackage struct {
+	Package string        `json:"package"`
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"elapsed"`
+	Output  string        `json:"output"`
+	Tests   []TestCase    `json:"tests"`
+}
+
+type TestCase struct {
+	Name    string        `json:"name"`
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"elapsed"`
+	Output  string        `json:"output"`
+}
+
+// Lines of every file, that tests ran or did not run
+type CoverageReport struct {
+	// Share of statements, that ran, from 0 to 100
+	Percent float64        `json:"percent"`
+	Files   []FileCoverage `json:"files"`
+}
+
+// Coverage of a single file, lines without statements are in neither of the ranges
+type FileCoverage struct {
+	File      string      `json:"file"`
+	Covered   []LineRange `json:"covered"`
+	Uncovered []LineRange `json:"uncovered"`
+}
+
+// Lines from Start to End inclusive, starting from 1
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Whether the tests ran a line, starting from 1
+func (f FileCoverage) IsCovered(line int) bool {
+	return inRanges(f.Covered, line)
+}
+
+// Whether the tests did not run a line, that has statements, starting from 1
+func (f FileCoverage) IsUncovered(line int) bool {
+	return inRanges(f.Uncovered, line)
+}
+
+func inRanges(ranges []LineRange, line int) bool {
+	for _, r := range ranges {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Profiles of a run, either of them is nil, when the program did not write it
+type ProfileReport struct {
+	CPU *Profile `json:"cpu"`
+	// Allocations over the whole run
+	Heap *Profile `json:"heap"`
+}
+
+// A profile in the pprof format with its functions, that cost the most
+type Profile struct {
+	// Can be opened with go tool pprof
+	Raw []byte         `json:"raw"`
+	Top []ProfileEntry `json:"top"`
+}
+
+// A row of the top table of go tool pprof
+type ProfileEntry struct {
+	Function string `json:"function"`
+	// Cost of the function itself, e.g. 120ms or 1.50MB
+	Flat        string  `json:"flat"`
+	FlatPercent float64 `json:"flatPercent"`
+	// Cost of the function and everything it called
+	Cum        string  `json:"cum"`
+	CumPercent float64 `json:"cumPercent"`
+}
+
+// Result of a single benchmark
+type Benchmark struct {
+	Package     string  `json:"package"`
+	Name        string  `json:"name"`
+	Procs       int     `json:"procs"`
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"nsPerOp"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
+}
+
+// A message from a compiler or a linter, tied to a position in code
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+	// Tool, that reported the message, e.g. vet, empty for the compiler
+	Source string `json:"source"`
+}
+
+// Formats a diagnostic the same way the go toolchain does
+func (d Diagnostic) String() string {
+	switch {
+	case len(d.File) == 0:
+		return d.Message
+	case d.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+}
+
+// A response of a run, that streams its output
+type streamedResp interface {
+	// Set on every response, except for the final one
+	chunk() *OutputChunk
+	// Amount of chunks before the final response
+	streamed() int
+	// Result of the final response, or an error, if the submission was rejected
+	final() (*RunResult, error)
+}
+
+// Publish a run, that streams its output, and send its chunks to events in order, followed by its result or an error
+func streamEvents[R any, P interface {
+	*R
+	streamedResp
+}](
+	ctx context.Context,
+	conn *amqp091.Connection,
+	sendq string,
+	recvq string,
+	sendObj any,
+	events chan<- RunEvent,
+) {
+	send := func(ev RunEvent) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// Messages, that other consumers put back into the queue, come out of order,
+	// so chunks are held until every chunk before them arrives
+	var (
+		next    int
+		pending = make(map[int]*OutputChunk)
+		final   P
+	)
+
+	err := publishHandleResponses(ctx, conn, sendq, sharedQueue, recvq, sendObj, func(resp *R) bool {
+		if chunk := P(resp).chunk(); chunk == nil {
+			final = resp
+		} else if chunk.Seq >= next {
+			pending[chunk.Seq] = chunk
+		}
+
+		for chunk, ok := pending[next]; ok; chunk, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if !send(RunEvent{Chunk: chunk}) {
+				return false
+			}
+		}
+
+		return final == nil || next < final.streamed()
+	})
+
+	if err != nil {
+		send(RunEvent{Err: err})
+		return
+	}
+	// Nobody reads the events anymore
+	if final == nil || next < final.streamed() {
+		return
+	}
+
+	res, err := final.final()
+	if err != nil {
+		send(RunEvent{Err: err})
+	} else {
+		send(RunEvent{Result: res})
+	}
 }
 
 func publishGetResponse[R any](
 	ctx context.Context,
 	conn *amqp091.Connection,
 	sendq string,
+	declare declareQueue,
 	recvq string,
 	sendObj any,
 ) (*R, error) {
+	var resp *R
+	err := publishHandleResponses(ctx, conn, sendq, declare, recvq, sendObj, func(r *R) bool {
+		resp = r
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Declares the queue, that a request is published to
+type declareQueue func(ch *amqp091.Channel, name string) (amqp091.Queue, error)
+
+// A queue, that every runner of a language reads requests from
+func sharedQueue(ch *amqp091.Channel, name string) (amqp091.Queue, error) {
+	return ch.QueueDeclare(name, true, false, false, false, nil)
+}
+
+// A queue, that a single runner declared for itself, it is only checked to exist, since it is deleted along with the runner
+func runnerQueue(ch *amqp091.Channel, name string) (amqp091.Queue, error) {
+	return ch.QueueDeclarePassive(name, false, true, false, false, nil)
+}
+
+// Publish a message and pass every response to it to handle, until handle returns false
+func publishHandleResponses[R any](
+	ctx context.Context,
+	conn *amqp091.Connection,
+	sendq string,
+	declare declareQueue,
+	recvq string,
+	sendObj any,
+	handle func(*R) bool,
+) error {
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, fmt.Errorf("creating mq chan: %w", err)
+		return fmt.Errorf("creating mq chan: %w", err)
 	}
 	defer ch.Close()
 
-	q, err := ch.QueueDeclare(sendq, true, false, false, false, nil)
+	q, err := declare(ch, sendq)
 	if err != nil {
-		return nil, fmt.Errorf("declaring send q: %w", err)
+		return fmt.Errorf("declaring send q: %w", err)
 	}
 
 	marshalled, err := json.Marshal(sendObj)
 	if err != nil {
-		return nil, fmt.Errorf("formatting send msg: %w", err)
+		return fmt.Errorf("formatting send msg: %w", err)
 	}
 
 	correlationId := uuid.New()
@@ -50,20 +334,20 @@ func publishGetResponse[R any](
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("publishing a message: %w", err)
+		return fmt.Errorf("publishing a message: %w", err)
 	}
 
-	/*** Receive response ***/
+	/*** Receive responses ***/
 
 	deliv, err := ch.Consume(recvq, "", false, false, false, false, nil)
 	if err != nil {
-		return nil, fmt.Errorf("consuming: %w", err)
+		return fmt.Errorf("consuming: %w", err)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("ctx cancelled")
+			return fmt.Errorf("ctx cancelled")
 
 		case msg := <-deliv:
 			if msg.CorrelationId != correlationId.String() {
@@ -74,13 +358,15 @@ func publishGetResponse[R any](
 			var resp R
 
 			if err := json.Unmarshal(msg.Body, &resp); err != nil {
-				slog.Error("Could not unmarshal message from broker: %w", err)
-				return nil, fmt.Errorf("unmarshalling msg %s: %w", msg.Body, err)
+				slog.Error("Could not unmarshal message from broker", slog.String("err", err.Error()))
+				return fmt.Errorf("unmarshalling msg %s: %w", msg.Body, err)
 			}
 
 			msg.Ack(false)
 
-			return &resp, nil
+			if !handle(&resp) {
+				return nil
+			}
 		}
 	}
 
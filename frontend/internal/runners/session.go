@@ -0,0 +1,122 @@
+package runners
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Queues of sessions, that were never consumed from, are deleted after this long
+//
+// Has to match the runners, which declare the same queue
+const sessionQueueExpiry = 10 * time.Minute
+
+// A message in the queue with input of a session
+type sessionInput struct {
+	Stdin string `json:"stdin,omitempty"`
+	// Close stdin of the program after writing Stdin
+	Close bool `json:"close,omitempty"`
+}
+
+// An interactive run, that reads input while it runs
+type Session struct {
+	// Chunks of output in order, followed by the result or an error, closed afterwards
+	Events <-chan RunEvent
+
+	cancel context.CancelFunc
+
+	// Publishing is not safe for concurrent use
+	mu    sync.Mutex
+	ch    *amqp091.Channel
+	queue string
+}
+
+// Declare the input queue of a session and publish a run, that reads from it
+//
+// The queue is declared first, so that input written before the runner starts the session is kept
+func startSession[R any, P interface {
+	*R
+	streamedResp
+}](
+	ctx context.Context,
+	conn *amqp091.Connection,
+	sendq string,
+	recvq string,
+	sessionq string,
+	sendObj any,
+	timeout time.Duration,
+) (*Session, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("creating mq chan: %w", err)
+	}
+
+	_, err = ch.QueueDeclare(sessionq, false, true, false, false, amqp091.Table{
+		"x-expires": int32(sessionQueueExpiry.Milliseconds()),
+	})
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("declaring session q: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	events := make(chan RunEvent)
+
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		streamEvents[R, P](ctx, conn, sendq, recvq, sendObj, events)
+	}()
+
+	return &Session{Events: events, cancel: cancel, ch: ch, queue: sessionq}, nil
+}
+
+// Write input to stdin of the program
+func (s *Session) Write(data string) error {
+	return s.publish(sessionInput{Stdin: data})
+}
+
+// Close stdin of the program, so that it reads an EOF after the input written before
+func (s *Session) CloseInput() error {
+	return s.publish(sessionInput{Close: true})
+}
+
+// Close stdin of the program, so that it can finish, and stop waiting for its events
+func (s *Session) Close() error {
+	defer s.cancel()
+
+	err := s.CloseInput()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if closeErr := s.ch.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (s *Session) publish(in sessionInput) error {
+	marshalled, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("formatting session input: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.ch.Publish("", s.queue, false, false, amqp091.Publishing{
+		ContentType: "application/json",
+		Body:        marshalled,
+	})
+	if err != nil {
+		return fmt.Errorf("publishing session input: %w", err)
+	}
+
+	return nil
+}
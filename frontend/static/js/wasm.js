@@ -0,0 +1,44 @@
+// Runs go programs built for the browser, which are swapped into the page as elements with a data-wasm url
+htmx.onLoad((elt) => {
+	const runs = elt.matches("[data-wasm]") ? [elt] : elt.querySelectorAll("[data-wasm]");
+	runs.forEach(runWasm);
+});
+
+const wasmDecoder = new TextDecoder("utf-8");
+
+// Load wasm_exec.js of the toolchain, that built the program, and run the program with it
+async function runWasm(elt) {
+	const url = elt.dataset.wasm;
+	const output = elt.querySelector("[data-wasm-output]");
+
+	try {
+		await loadScript(url + "/wasm_exec.js");
+
+		// Output of the program goes to the page instead of the console
+		globalThis.fs.writeSync = (fd, buf) => {
+			const chunk = document.createElement("span");
+			if (fd === 2) {
+				chunk.className = "text-red-100";
+			}
+			chunk.textContent = wasmDecoder.decode(buf);
+			output.append(chunk);
+			return buf.length;
+		};
+
+		const go = new Go();
+		const { instance } = await WebAssembly.instantiateStreaming(fetch(url + "/main.wasm"), go.importObject);
+		await go.run(instance);
+	} catch (err) {
+		output.append("Could not run the program: " + err);
+	}
+}
+
+function loadScript(src) {
+	return new Promise((resolve, reject) => {
+		const script = document.createElement("script");
+		script.src = src;
+		script.onload = resolve;
+		script.onerror = () => reject(new Error("could not load " + src));
+		document.head.append(script);
+	});
+}
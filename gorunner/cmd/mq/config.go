@@ -3,8 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/Marattttt/personal-page/gorunner/internal/config"
+	"github.com/Marattttt/personal-page/gorunner/pkg/runtime"
+	"github.com/Marattttt/personal-page/gorunner/pkg/seccomp"
 	"github.com/sethvargo/go-envconfig"
 )
 
@@ -24,6 +29,11 @@ type MQConfig struct {
 	Password string `env:"PASS, default=guest"`
 	RecvQ    string `env:"RECVQ, default=gorunner"`
 	RespondQ string `env:"RESPQ, default=gorunner-response"`
+	// Prefix of queues with input of sessions, input of a session is read from <prefix>.<session id>
+	SessionQ string `env:"SESSIONQ, default=gorunner-session"`
+	// Prefix of queues with downloads, binaries are only kept by the runner, that built them,
+	// so it reads downloads from <prefix>.<instance id>, which is returned along with every binary
+	DownloadQ string `env:"DOWNLOADQ, default=gorunner-download"`
 }
 
 func (m MQConfig) URL() string {
@@ -34,6 +44,198 @@ type RuntimeConfig struct {
 	RunAs     *string `env:"USERNAME, noinit"`
 	RunAsPass *string `env:"PASS, noinit"`
 	Dir       string  `env:"DIR, default=./runtimedir"`
+
+	// Amount of submissions run in parallel, each slot gets its own directory under Dir
+	Slots int `env:"SLOTS, default=1"`
+	// Comma separated users, one for every slot, take precedence over RunAs
+	SlotUsers []string `env:"SLOT_USERNAMES"`
+
+	// Wall-clock limit of a single run
+	Timeout time.Duration `env:"TIMEOUT, default=10s"`
+	// Limits of interactive sessions, which replace Timeout for them
+	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT, default=1m"`
+	SessionTimeout     time.Duration `env:"SESSION_TIMEOUT, default=5m"`
+	// Bytes of output kept from each of stdout and stderr
+	OutputStreamMax int `env:"OUTPUT_STREAM_MAX, default=1048576"`
+	// Bytes of output kept from stdout and stderr combined
+	OutputTotalMax int `env:"OUTPUT_TOTAL_MAX, default=1572864"`
+	// Bytes of a WebAssembly binary, that is returned for the browser, larger ones are rejected
+	WasmMax int64 `env:"WASM_MAX, default=8388608"`
+	// Bytes of a coverage profile, that tests write, larger ones are rejected
+	CoverMax int64 `env:"COVER_MAX, default=4194304"`
+	// Bytes of a cpu or heap profile, that is returned, larger ones are rejected
+	ProfileMax int64 `env:"PROFILE_MAX, default=4194304"`
+
+	// Parent cgroup v2 for runs, only used when any of the limits is set
+	Cgroup string `env:"CGROUP, default=/sys/fs/cgroup/gorunner"`
+	// Memory limit in bytes
+	MemoryMax int64 `env:"MEMORY_MAX"`
+	// Amount of cpus, e.g. 0.5
+	CPUMax float64 `env:"CPU_MAX"`
+	// Limit on processes and threads
+	PidsMax int64 `env:"PIDS_MAX"`
+	// Limits of the toolchain, that builds submissions, the limits of runs apply to it, when none of them is set
+	ToolchainMemoryMax int64   `env:"TOOLCHAIN_MEMORY_MAX"`
+	ToolchainCPUMax    float64 `env:"TOOLCHAIN_CPU_MAX"`
+	ToolchainPidsMax   int64   `env:"TOOLCHAIN_PIDS_MAX"`
+
+	// Run submissions in new network, pid, mount and ipc namespaces, with only loopback available.
+	// Linux-only, requires CAP_SYS_ADMIN
+	Namespaces bool `env:"NAMESPACES"`
+
+	// Path of the seccomp-exec helper, user programs are started through it when set
+	SeccompExec string `env:"SECCOMP_EXEC"`
+	// Syscalls allowed to user programs, deny for everything except dangerous ones, or strict
+	SeccompProfile string `env:"SECCOMP_PROFILE, default=deny"`
+
+	// Comma separated GOROOTs of installed toolchains, the first one is the default.
+	// Go from PATH is used when empty
+	GoRoots []string `env:"GOROOTS"`
+
+	// Directory for binaries of previous builds, caching is disabled when empty, requires SlotUsers with multiple slots
+	CacheDir string `env:"CACHE_DIR"`
+	// Total size of cached binaries in bytes
+	CacheMax int64 `env:"CACHE_MAX, default=268435456"`
+
+	// Directory for binaries built for download, such builds are disabled when empty
+	ArtifactDir string `env:"ARTIFACT_DIR"`
+	// Comma separated GOOS/GOARCH pairs, that binaries for download may be built for
+	ArtifactPlatforms []string `env:"ARTIFACT_PLATFORMS, default=linux/amd64,linux/arm64,darwin/amd64,darwin/arm64,windows/amd64"`
+	// Largest binary for download in bytes
+	ArtifactSizeMax int64 `env:"ARTIFACT_SIZE_MAX, default=33554432"`
+	// Total size of binaries for download in bytes, the oldest ones are removed to fit it
+	ArtifactTotalMax int64 `env:"ARTIFACT_TOTAL_MAX, default=268435456"`
+	// How long a binary can be downloaded after it was built
+	ArtifactTTL time.Duration `env:"ARTIFACT_TTL, default=10m"`
+
+	// Comma separated modules, that submissions may import, e.g. github.com/google/uuid@v1.6.0
+	Modules []string `env:"MODULES"`
+	// Module cache, that is populated with the modules and their dependencies beforehand
+	ModuleCache string `env:"MODULE_CACHE"`
+
+	// Build options, that submissions may set, nothing but the defaults is allowed when unset
+	AllowRace bool `env:"ALLOW_RACE"`
+	// Comma separated build tags
+	AllowedTags []string `env:"ALLOWED_TAGS"`
+	// Comma separated values of -gcflags, e.g. -N -l,-m
+	AllowedGCFlags []string `env:"ALLOWED_GCFLAGS"`
+	// Whether submissions may enable cgo, requires a C compiler
+	AllowCGO bool `env:"ALLOW_CGO"`
+	// Comma separated GOEXPERIMENT values, e.g. rangefunc
+	AllowedExperiments []string `env:"ALLOWED_GOEXPERIMENTS"`
+
+	// Comma separated NAME:value pairs, that user programs start with, variables of the runner are never passed on
+	BaseEnv map[string]string `env:"BASE_ENV, default=PATH:/usr/local/bin:/usr/bin:/bin"`
+	// Comma separated variables, that submissions can not set, a trailing * matches any suffix
+	ProtectedEnv []string `env:"PROTECTED_ENV, default=PATH,HOME"`
+}
+
+// Directory of a single slot
+func (r RuntimeConfig) SlotDir(slot int) string {
+	return filepath.Join(r.Dir, fmt.Sprintf("slot-%d", slot))
+}
+
+// User to run submissions of a slot as, nil to run as the current user
+func (r RuntimeConfig) SlotUser(slot int) *string {
+	if len(r.SlotUsers) > 0 {
+		return &r.SlotUsers[slot]
+	}
+	return r.RunAs
+}
+
+// Allowed modules, nil if there are none
+func (r RuntimeConfig) AllowedModules() (*runtime.Modules, error) {
+	if len(r.Modules) == 0 {
+		return nil, nil
+	}
+	if r.ModuleCache == "" {
+		return nil, fmt.Errorf("a module cache is required to allow modules")
+	}
+
+	modules := make([]runtime.Module, 0, len(r.Modules))
+	for _, s := range r.Modules {
+		mod, err := runtime.ParseModule(s)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, mod)
+	}
+
+	return runtime.NewModules(r.ModuleCache, modules)
+}
+
+func (r RuntimeConfig) BuildPolicy() runtime.BuildPolicy {
+	return runtime.BuildPolicy{
+		Race:        r.AllowRace,
+		Tags:        r.AllowedTags,
+		GCFlags:     r.AllowedGCFlags,
+		CGO:         r.AllowCGO,
+		Experiments: r.AllowedExperiments,
+	}
+}
+
+// Platforms, that binaries for download may be built for
+func (r RuntimeConfig) Platforms() ([]runtime.Platform, error) {
+	platforms := make([]runtime.Platform, 0, len(r.ArtifactPlatforms))
+	for _, s := range r.ArtifactPlatforms {
+		platform, err := runtime.ParsePlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+
+	return platforms, nil
+}
+
+func (r RuntimeConfig) ArtifactLimits() runtime.ArtifactLimits {
+	return runtime.ArtifactLimits{
+		Size:  r.ArtifactSizeMax,
+		Total: r.ArtifactTotalMax,
+		TTL:   r.ArtifactTTL,
+	}
+}
+
+func (r RuntimeConfig) Environment() runtime.Environment {
+	return runtime.Environment{
+		Base:      r.BaseEnv,
+		Protected: r.ProtectedEnv,
+	}
+}
+
+func (r RuntimeConfig) OutputLimits() runtime.OutputLimits {
+	return runtime.OutputLimits{
+		Stream: r.OutputStreamMax,
+		Total:  r.OutputTotalMax,
+	}
+}
+
+func (r RuntimeConfig) SessionLimits() runtime.SessionLimits {
+	return runtime.SessionLimits{
+		Idle:  r.SessionIdleTimeout,
+		Total: r.SessionTimeout,
+	}
+}
+
+func (r RuntimeConfig) Limits() runtime.Limits {
+	return runtime.Limits{
+		Memory: r.MemoryMax,
+		CPU:    r.CPUMax,
+		Pids:   r.PidsMax,
+	}
+}
+
+// Limits of the toolchain, nil when the limits of runs apply to it
+func (r RuntimeConfig) ToolchainLimits() *runtime.Limits {
+	limits := runtime.Limits{
+		Memory: r.ToolchainMemoryMax,
+		CPU:    r.ToolchainCPUMax,
+		Pids:   r.ToolchainPidsMax,
+	}
+	if limits == (runtime.Limits{}) {
+		return nil
+	}
+	return &limits
 }
 
 func CreateConfig(ctx context.Context) (*Config, error) {
@@ -42,5 +244,28 @@ func CreateConfig(ctx context.Context) (*Config, error) {
 		return nil, err
 	}
 
+	if conf.Runtime.Slots < 1 {
+		return nil, fmt.Errorf("at least 1 runtime slot is required, got %d", conf.Runtime.Slots)
+	}
+	if len(conf.Runtime.SlotUsers) > 0 && len(conf.Runtime.SlotUsers) != conf.Runtime.Slots {
+		return nil, fmt.Errorf("got %d slot users for %d slots", len(conf.Runtime.SlotUsers), conf.Runtime.Slots)
+	}
+	// Slots, that share a user, could read and overwrite files of each other
+	for i, user := range conf.Runtime.SlotUsers {
+		if slices.Index(conf.Runtime.SlotUsers[:i], user) >= 0 {
+			return nil, fmt.Errorf("slot user %q is given more than once", user)
+		}
+	}
+	// A run could overwrite the binary of another slot between its build and caching, storing it under the key of that slot
+	if conf.Runtime.CacheDir != "" && conf.Runtime.Slots > 1 && len(conf.Runtime.SlotUsers) == 0 {
+		return nil, fmt.Errorf("the build cache needs a user for every slot, when there are %d slots", conf.Runtime.Slots)
+	}
+	if _, err := seccomp.ParseProfile(conf.Runtime.SeccompProfile); err != nil {
+		return nil, err
+	}
+	if _, err := conf.Runtime.Platforms(); err != nil {
+		return nil, err
+	}
+
 	return &conf, nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Marattttt/personal-page/gorunner/pkg/runtime"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Declare the download queue of this runner and start consuming from it
+//
+// Binaries are kept on the disk of the runner, that built them, so downloads can not be read from the shared queue.
+// The queue is deleted, once the runner stops, after which its binaries can not be downloaded either
+func consumeDownloads(ctx context.Context, ch *amqp091.Channel, prefix string) (string, <-chan amqp091.Delivery, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("generating instance id: %w", err)
+	}
+
+	q, err := ch.QueueDeclare(prefix+"."+hex.EncodeToString(random), false, true, false, false, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("declaring download queue: %w", err)
+	}
+
+	d, err := ch.ConsumeWithContext(ctx, q.Name, "", false, true, false, false, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("consuming downloads: %w", err)
+	}
+
+	return q.Name, d, nil
+}
+
+// Answer every download from d, until it is closed
+func serveDownloads(d <-chan amqp091.Delivery, artifacts *runtime.ArtifactStore, send chan Resp) {
+	for msg := range d {
+		var req Req
+		if err := json.Unmarshal(msg.Body, &req); err != nil {
+			msg.Reject(false)
+			slog.Warn("Could not decode broker's message body", slog.String("err", err.Error()))
+			continue
+		}
+
+		resp := Resp{Error: fmt.Sprintf("only %q requests are read from the download queue", opDownload)}
+		if req.Op == opDownload {
+			resp = download(artifacts, req)
+		}
+		resp.CorrelationID = msg.CorrelationId
+		send <- resp
+		msg.Ack(false)
+	}
+}
+
+// Read a binary built for download, unknown and expired tokens are answered with an error
+func download(artifacts *runtime.ArtifactStore, req Req) Resp {
+	artifact, binary, err := artifacts.Get(req.Token)
+	if errors.Is(err, runtime.ErrInvalidSubmission) {
+		slog.Warn("Rejected a download", slog.String("err", err.Error()))
+		return Resp{Error: err.Error()}
+	} else if err != nil {
+		slog.Error("Could not read an artifact", slog.String("err", err.Error()))
+		return Resp{Error: "could not read the artifact"}
+	}
+
+	return Resp{Artifact: artifact, Binary: binary}
+}
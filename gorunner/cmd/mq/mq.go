@@ -3,31 +3,193 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/user"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/Marattttt/personal-page-libs/userenv"
 	"github.com/Marattttt/personal-page/gorunner/pkg/runtime"
+	"github.com/Marattttt/personal-page/gorunner/pkg/seccomp"
 	"github.com/joho/godotenv"
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// Kinds of requests
+const (
+	// Build and run a submission, the default
+	opRun = "run"
+	// Run tests of a submission with go test
+	opTest = "test"
+	// Run benchmarks of a submission with go test -bench
+	opBench = "bench"
+	// Check a submission with go vet, gofmt and the import policy without running it
+	opAnalyze = "analyze"
+	// Format go files of a submission with gofmt
+	opFormat = "format"
+	// List features of the runner, e.g. installed go versions
+	opCapabilities = "capabilities"
+	// Run a submission interactively, writing input from the queue of the session to it while it runs
+	opSession = "session"
+	// Build a submission with GOOS=js GOARCH=wasm and return the binary in place of running it
+	opWasm = "wasm"
+	// Cross-compile a submission for an allowed platform and keep the binary for download under a token
+	opArtifact = "artifact"
+	// Get a binary built by opArtifact by its token, only read from Resp.DownloadQ of the runner, that built it
+	opDownload = "download"
+	// Run a submission, or its benchmarks, with cpu and heap profiling
+	opProfile = "profile"
+)
+
 type Req struct {
+	// One of the op constants, empty for opRun
+	Op string `json:"op"`
+
+	// Contents of main.go, a shorthand for single-file submissions
 	Code string `json:"code"`
+	// Source tree of the submission, keyed by path relative to module root
+	Files map[string]string `json:"files"`
+
+	// Passed to the program, never to the shell that starts it
+	Stdin string   `json:"stdin"`
+	Args  []string `json:"args"`
+	// Set over the base environment of the runner, protected variables can not be set
+	Env map[string]string `json:"env"`
+
+	// Installed toolchain to build with, e.g. go1.23.1, empty for the default one
+	GoVersion string `json:"goVersion"`
+	// Optional build settings, every one of them has to be allowed by the runner's configuration
+	Build runtime.BuildOptions `json:"build"`
+
+	// Publish output of the program while it runs, before the final response, only used by opRun
+	Stream bool `json:"stream"`
+
+	// Measure line coverage of the tests, only used by opTest
+	Cover bool `json:"cover"`
+
+	// Duration or number of iterations of every benchmark, e.g. 1s or 100x, only used by opBench and opProfile
+	Benchtime string `json:"benchtime"`
+	// Profile benchmarks of the package at the module root instead of the program, only used by opProfile
+	ProfileBench bool `json:"profileBench"`
+
+	// Id of a session, chosen by the client, only used by opSession
+	Session string `json:"session"`
+
+	// GOOS/GOARCH pair, e.g. linux/arm64, only used by opArtifact
+	Platform string `json:"platform"`
+	// Returned by opArtifact, only used by opDownload
+	Token string `json:"token"`
+}
+
+// Combine code and files into a single source tree
+func (r Req) files() (runtime.Files, error) {
+	files := make(runtime.Files, len(r.Files)+1)
+	for name, content := range r.Files {
+		files[name] = content
+	}
+
+	if len(r.Code) > 0 {
+		if _, ok := files["main.go"]; ok {
+			return nil, fmt.Errorf("%w: main.go is provided both as code and as a file", runtime.ErrInvalidSubmission)
+		}
+		files["main.go"] = r.Code
+	}
+
+	return files, nil
 }
 
 type Resp struct {
+	// Build phase, its diagnostics are set when the submission did not compile
+	Compile *runtime.CompileResult `json:"compile,omitempty"`
+
 	Stdout   []byte        `json:"stdout"`
 	Stderr   []byte        `json:"stderr"`
 	TimeTook time.Duration `json:"timeTook"`
 	ExitCode int           `json:"exitCode"`
+	// Whether outputs were cut short because of output limits
+	StdoutTruncated bool `json:"stdoutTruncated,omitempty"`
+	StderrTruncated bool `json:"stderrTruncated,omitempty"`
+	// Whether the run was killed after reaching the timeout
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Resource limit that caused the run to be killed
+	LimitHit     string `json:"limitHit,omitempty"`
+	CPUThrottled bool   `json:"cpuThrottled,omitempty"`
+	// Whether the program was killed for a syscall, that the seccomp profile does not allow
+	SyscallBlocked bool `json:"syscallBlocked,omitempty"`
+	// Whether compilation was skipped thanks to the build cache
+	CacheHit bool `json:"cacheHit,omitempty"`
+	// Version of the toolchain, that built the submission
+	GoVersion string `json:"goVersion,omitempty"`
+
+	// Results of go test, set in response to an opTest request
+	Tests *runtime.TestReport `json:"tests,omitempty"`
+	// Lines, that the tests ran, set in response to an opTest request with Cover, when the tests built
+	Coverage *runtime.CoverageReport `json:"coverage,omitempty"`
+	// Results of benchmarks, set in response to an opBench request
+	Benchmarks []runtime.Benchmark `json:"benchmarks,omitempty"`
+	// Data races, set when the submission was built with the race detector
+	Races []runtime.RaceReport `json:"races,omitempty"`
+
+	// Set in response to an opAnalyze request, in place of the fields of a run
+	Analysis *runtime.AnalysisResult `json:"analysis,omitempty"`
+
+	// Set in response to an opFormat request
+	Format *runtime.FormatResult `json:"format,omitempty"`
+
+	// Set in response to an opCapabilities request
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// Set when the submission was rejected without running
+	Error string `json:"error,omitempty"`
+
+	// Output of a streamed run, messages with a chunk precede the final response
+	Chunk *runtime.OutputChunk `json:"chunk,omitempty"`
+	// Amount of chunks, that preceded the final response of a streamed run
+	Streamed int `json:"streamed,omitempty"`
+
+	// Id of the session, that the chunk or the result belongs to
+	Session string `json:"session,omitempty"`
+	// Whether the session was stopped after going without input or output for too long
+	IdleTimedOut bool `json:"idleTimedOut,omitempty"`
+
+	// Set in response to an opWasm request, when the submission compiled
+	Wasm *runtime.WasmArtifact `json:"wasm,omitempty"`
+	// Set in response to an opArtifact request, when the submission compiled, and to an opDownload request
+	Artifact *runtime.Artifact `json:"artifact,omitempty"`
+	// Contents of the artifact, set in response to an opDownload request
+	Binary []byte `json:"binary,omitempty"`
+	// Queue, that downloads of the artifact are sent to, set along with Artifact in response to an opArtifact request
+	DownloadQ string `json:"downloadQ,omitempty"`
+
+	// Set in response to an opProfile request, when the program wrote any profiles
+	Profile *runtime.ProfileReport `json:"profile,omitempty"`
+
+	// Detected at startup, set on every response
+	Versions Versions `json:"versions"`
 
 	CorrelationID string `json:"-"`
 }
 
+// Versions of the toolchains, that build submissions
+type Versions struct {
+	Go        []string `json:"go"`
+	DefaultGo string   `json:"defaultGo"`
+}
+
+// Features of the runner
+type Capabilities struct {
+	GoVersions       []string `json:"goVersions"`
+	DefaultGoVersion string   `json:"defaultGoVersion"`
+	// Build options, that requests may set
+	BuildOptions runtime.BuildPolicy `json:"buildOptions"`
+	// GOOS/GOARCH pairs, that opArtifact can build for, empty when it is disabled
+	Platforms []string `json:"platforms"`
+}
+
 func main() {
 	appctx, appcancel := context.WithCancel(context.TODO())
 	defer appcancel()
@@ -43,20 +205,33 @@ func main() {
 
 	checkFatal(conf.Apply(), "Could not apply config")
 
+	toolchains, err := createToolchains(appctx, *conf)
+	checkFatal(err, "Registering go toolchains")
+	slog.Info("Using go toolchains", slog.Any("versions", toolchains.Versions()), slog.String("default", toolchains.Default().Version))
+
+	artifacts, err := createArtifacts(*conf)
+	checkFatal(err, "Creating artifact store")
+
+	slots, err := createSlots(*conf, toolchains, artifacts)
+	checkFatal(err, "Cretaing runtime")
+
+	// Nothing is consumed until every slot is known to build and run programs
+	checkFatal(selfTest(appctx, slots), "Self test failed")
+
 	conn, err := amqp091.Dial(conf.MQ.URL())
 	checkFatal(err, "Dialling "+conf.MQ.URL())
 
 	sendmsg := make(chan Resp)
 
 	go func() {
-		consume(appctx, conf, conn, sendmsg)
+		consume(appctx, conf, conn, toolchains, slots, artifacts, sendmsg)
 		// Closing the sendmsg channel signals to finish reading from it and stop the producer
 		// goroutine, which leads to all remaining messages being sent to mq before shutdown
 		close(sendmsg)
 	}()
 
 	go func() {
-		produce(appctx, conf, conn, sendmsg)
+		produce(appctx, conf, conn, Versions{Go: toolchains.Versions(), DefaultGo: toolchains.Default().Version}, sendmsg)
 		slog.Info("Stopped message production")
 		appcancel()
 	}()
@@ -72,20 +247,54 @@ func checkFatal(err error, msg string) {
 	}
 }
 
-func consume(ctx context.Context, conf *Config, conn *amqp091.Connection, send chan Resp) {
+func consume(
+	ctx context.Context,
+	conf *Config,
+	conn *amqp091.Connection,
+	toolchains *runtime.Toolchains,
+	slots chan Runtime,
+	artifacts *runtime.ArtifactStore,
+	send chan Resp,
+) {
 	ch, err := conn.Channel()
-	// Cannot continue operationg on an error of such level
+	// Cannot continue operationg on an error of such level
 	checkFatal(err, "Obtaining a channel from MQ")
 
+	// Never hold more messages than there are free slots to run them
+	checkFatal(ch.Qos(conf.Runtime.Slots, 0, false), "Setting prefetch count")
+
 	q, err := ch.QueueDeclare(conf.MQ.RecvQ, true, false, false, false, nil)
 	checkFatal(err, "Declaring receive queue")
 
 	d, err := ch.ConsumeWithContext(ctx, q.Name, "", false, false, false, false, nil)
 	checkFatal(err, "Creating a consume channel")
 
-	runtimeLock := sync.Mutex{}
-	run, err := createRuntime(*conf, &runtimeLock)
-	checkFatal(err, "Cretaing runtime")
+	capabilities := &Capabilities{
+		GoVersions:       toolchains.Versions(),
+		DefaultGoVersion: toolchains.Default().Version,
+		BuildOptions:     conf.Runtime.BuildPolicy(),
+	}
+	if artifacts != nil {
+		capabilities.Platforms = conf.Runtime.ArtifactPlatforms
+	}
+
+	// Runs, that may still send a response
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	var downloadQ string
+	if artifacts != nil {
+		var downloads <-chan amqp091.Delivery
+		downloadQ, downloads, err = consumeDownloads(ctx, ch, conf.MQ.DownloadQ)
+		checkFatal(err, "Consuming downloads")
+		slog.Info("Serving downloads", slog.String("queue", downloadQ))
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			serveDownloads(downloads, artifacts, send)
+		}()
+	}
 
 	for msg := range d {
 		var req Req
@@ -95,69 +304,410 @@ func consume(ctx context.Context, conf *Config, conn *amqp091.Connection, send c
 			continue
 		}
 
-		defer func() {
-			if cause := recover(); cause != nil {
-				if err, ok := cause.(error); ok {
-					slog.Error("Recovered from panic in main/consume (error)", slog.String("err", err.Error()))
-				} else {
-					slog.Error("Recovered from panic in main/consume (not an error)", slog.Any("cause", cause))
+		switch req.Op {
+		case "", opRun, opTest, opBench, opAnalyze, opSession, opWasm, opArtifact, opProfile:
+		case opCapabilities:
+			// Does not need a slot
+			send <- Resp{Capabilities: capabilities, CorrelationID: msg.CorrelationId}
+			msg.Ack(false)
+			continue
+		case opFormat:
+			// Runs in-process and does not execute anything, so it does not need a slot either
+			resp := format(req)
+			resp.CorrelationID = msg.CorrelationId
+			send <- resp
+			msg.Ack(false)
+			continue
+		case opDownload:
+			// Another runner could have built the binary
+			send <- Resp{Error: "downloads are sent to the download queue of the runner, that built the binary", CorrelationID: msg.CorrelationId}
+			msg.Ack(false)
+			continue
+		default:
+			slog.Warn("Rejected a request with unknown op", slog.String("op", req.Op))
+			send <- Resp{Error: fmt.Sprintf("unknown op %q", req.Op), CorrelationID: msg.CorrelationId}
+			msg.Ack(false)
+			continue
+		}
+
+		// Wait for a free slot
+		run := <-slots
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer func() { slots <- run }()
+
+			defer func() {
+				if cause := recover(); cause != nil {
+					if err, ok := cause.(error); ok {
+						slog.Error("Recovered from panic in main/consume (error)", slog.String("err", err.Error()))
+					} else {
+						slog.Error("Recovered from panic in main/consume (not an error)", slog.Any("cause", cause))
+					}
+					msg.Reject(false)
+				}
+			}()
+
+			// Chunks are sent from the same goroutine one after another, so they reach the queue in order
+			var streamed int
+			var onOutput func(runtime.OutputChunk)
+			if req.Stream || req.Op == opSession {
+				onOutput = func(chunk runtime.OutputChunk) {
+					send <- Resp{Chunk: &chunk, Session: req.Session, CorrelationID: msg.CorrelationId}
+					streamed++
 				}
 			}
+
+			// Stops reading input of a session
+			done := make(chan struct{})
+			defer close(done)
+
+			stdin, err := sessionInput(conn, conf.MQ.SessionQ, req, done)
+			var resp Resp
+			if err == nil {
+				resp, err = handle(ctx, run, req, onOutput, stdin)
+			}
+			// Requeueing a submission that is invalid by itself would never succeed
+			if errors.Is(err, runtime.ErrInvalidSubmission) {
+				slog.Warn("Rejected an invalid submission", slog.String("err", err.Error()))
+				resp = Resp{Error: err.Error()}
+			} else if err != nil && req.Op == opSession {
+				// Input of a session was already consumed, a requeued one would run without it
+				slog.Error("Could not run a session", slog.String("session", req.Session), slog.String("err", err.Error()))
+				resp = Resp{Error: err.Error()}
+			} else if err != nil {
+				msg.Reject(true)
+				slog.Error("Could not execute code from mq", slog.String("err", err.Error()))
+				return
+			}
+
+			resp.CorrelationID = msg.CorrelationId
+			resp.Streamed = streamed
+			resp.Session = req.Session
+			if resp.Artifact != nil {
+				resp.DownloadQ = downloadQ
+			}
+			send <- resp
+
+			msg.Ack(false)
 		}()
+	}
+}
+
+// Execute a single request, passing output of a run to onOutput while it runs, if it is not nil
+//
+// Input of a session is received from stdin
+func handle(ctx context.Context, run Runtime, req Req, onOutput func(runtime.OutputChunk), stdin <-chan []byte) (Resp, error) {
+	files, err := req.files()
+	if err != nil {
+		return Resp{}, err
+	}
+
+	run, err = run.WithGoVersion(req.GoVersion)
+	if err != nil {
+		return Resp{}, err
+	}
+
+	run, err = run.WithBuildOptions(req.Build)
+	if err != nil {
+		return Resp{}, err
+	}
+
+	if onOutput != nil {
+		run = run.WithOutputHandler(onOutput)
+	}
 
-		rex, err := run.Run(ctx, req.Code)
+	if req.Op == opAnalyze {
+		analysis, err := run.Analyze(ctx, files)
 		if err != nil {
-			msg.Reject(true)
-			slog.Error("Could not execute code from mq", slog.String("err", err.Error()))
-			continue
+			return Resp{}, err
 		}
+		return Resp{Analysis: analysis}, nil
+	}
 
-		resp := Resp{
-			Stdout:   rex.Stdout,
-			Stderr:   rex.Stderr,
-			ExitCode: rex.ExitCode,
-			TimeTook: rex.TimeTook,
-
-			CorrelationID: msg.CorrelationId,
+	var rex *runtime.RunResult
+	switch req.Op {
+	case opTest:
+		if req.Cover {
+			rex, err = run.Cover(ctx, files)
+		} else {
+			rex, err = run.Test(ctx, files)
+		}
+	case opBench:
+		rex, err = run.Bench(ctx, files, req.Benchtime)
+	case opWasm:
+		rex, err = run.BuildWasm(ctx, files)
+	case opProfile:
+		if req.ProfileBench {
+			rex, err = run.ProfileBench(ctx, files, req.Benchtime)
+		} else {
+			rex, err = run.Profile(ctx, files, runtime.Input{Stdin: []byte(req.Stdin), Args: req.Args, Env: req.Env})
 		}
+	case opArtifact:
+		var platform runtime.Platform
+		platform, err = runtime.ParsePlatform(req.Platform)
+		if err == nil {
+			rex, err = run.BuildArtifact(ctx, files, platform)
+		}
+	case opSession:
+		rex, err = run.RunSession(ctx, files, runtime.Input{Stdin: []byte(req.Stdin), Args: req.Args, Env: req.Env}, stdin)
+	default:
+		rex, err = run.RunWithInput(ctx, files, runtime.Input{Stdin: []byte(req.Stdin), Args: req.Args, Env: req.Env})
+	}
+	if err != nil {
+		return Resp{}, err
+	}
+
+	return Resp{
+		Compile: rex.Compile,
+
+		Stdout:   rex.Stdout,
+		Stderr:   rex.Stderr,
+		ExitCode: rex.ExitCode,
+		TimeTook: rex.TimeTook,
+
+		StdoutTruncated: rex.StdoutTruncated,
+		StderrTruncated: rex.StderrTruncated,
+
+		TimedOut:       rex.TimedOut,
+		LimitHit:       rex.LimitHit,
+		CPUThrottled:   rex.CPUThrottled,
+		SyscallBlocked: rex.SyscallBlocked,
+
+		CacheHit:  rex.CacheHit,
+		GoVersion: rex.GoVersion,
+
+		Tests:      rex.Tests,
+		Coverage:   rex.Coverage,
+		Benchmarks: rex.Benchmarks,
+		Races:      rex.Races,
 
-		send <- resp
+		IdleTimedOut: rex.IdleTimedOut,
 
-		msg.Ack(false)
+		Wasm:     rex.Wasm,
+		Artifact: rex.Artifact,
+		Profile:  rex.Profile,
+	}, nil
+}
+
+// Format a submission, invalid ones are answered with an error
+func format(req Req) Resp {
+	files, err := req.files()
+	if err != nil {
+		return Resp{Error: err.Error()}
 	}
+
+	res, err := runtime.Format(files)
+	if err != nil {
+		slog.Warn("Rejected an invalid submission", slog.String("err", err.Error()))
+		return Resp{Error: err.Error()}
+	}
+
+	return Resp{Format: res}
 }
 
 type Runtime interface {
-	Run(ctx context.Context, code string) (*runtime.RunResult, error)
+	RunWithInput(ctx context.Context, files runtime.Files, input runtime.Input) (*runtime.RunResult, error)
+	Test(ctx context.Context, files runtime.Files) (*runtime.RunResult, error)
+	Cover(ctx context.Context, files runtime.Files) (*runtime.RunResult, error)
+	Bench(ctx context.Context, files runtime.Files, benchtime string) (*runtime.RunResult, error)
+	RunSession(ctx context.Context, files runtime.Files, input runtime.Input, stdin <-chan []byte) (*runtime.RunResult, error)
+	BuildWasm(ctx context.Context, files runtime.Files) (*runtime.RunResult, error)
+	Profile(ctx context.Context, files runtime.Files, input runtime.Input) (*runtime.RunResult, error)
+	ProfileBench(ctx context.Context, files runtime.Files, benchtime string) (*runtime.RunResult, error)
+	BuildArtifact(ctx context.Context, files runtime.Files, platform runtime.Platform) (*runtime.RunResult, error)
+	Analyze(ctx context.Context, files runtime.Files) (*runtime.AnalysisResult, error)
+	WithGoVersion(version string) (runtime.Runtime, error)
+	WithBuildOptions(opts runtime.BuildOptions) (runtime.Runtime, error)
+	WithOutputHandler(handler func(runtime.OutputChunk)) runtime.Runtime
+	SelfTest(ctx context.Context) error
+}
+
+// Register configured toolchains, or the one found in PATH when there are none
+func createToolchains(ctx context.Context, conf Config) (*runtime.Toolchains, error) {
+	if len(conf.Runtime.GoRoots) == 0 {
+		slog.Info("No GOROOTs configured, using go from PATH")
+		return runtime.DetectToolchains(ctx)
+	}
+
+	return runtime.NewToolchains(ctx, conf.Runtime.GoRoots)
+}
+
+// Create the store of binaries for download, nil when such builds are disabled
+func createArtifacts(conf Config) (*runtime.ArtifactStore, error) {
+	if conf.Runtime.ArtifactDir == "" {
+		return nil, nil
+	}
+
+	slog.Info("Building binaries for download",
+		slog.String("dir", conf.Runtime.ArtifactDir),
+		slog.Any("platforms", conf.Runtime.ArtifactPlatforms),
+		slog.Duration("ttl", conf.Runtime.ArtifactTTL))
+
+	return runtime.NewArtifactStore(conf.Runtime.ArtifactDir, conf.Runtime.ArtifactLimits())
+}
+
+// Run the self test of every slot, each of them may run as a different user
+func selfTest(ctx context.Context, slots chan Runtime) error {
+	for slot := range cap(slots) {
+		run := <-slots
+		err := run.SelfTest(ctx)
+		slots <- run
+		if err != nil {
+			return fmt.Errorf("slot %d: %w", slot, err)
+		}
+	}
+
+	slog.Info("Passed self test", slog.Int("slots", cap(slots)))
+	return nil
+}
+
+// Create a runtime for every slot, a runtime is taken from the channel for a run and returned after it
+func createSlots(conf Config, toolchains *runtime.Toolchains, artifacts *runtime.ArtifactStore) (chan Runtime, error) {
+	var cache *runtime.BuildCache
+	if conf.Runtime.CacheDir != "" {
+		var err error
+		cache, err = runtime.NewBuildCache(conf.Runtime.CacheDir, conf.Runtime.CacheMax)
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Info("Caching builds", slog.String("dir", conf.Runtime.CacheDir), slog.Int64("maxBytes", conf.Runtime.CacheMax))
+	}
+
+	modules, err := conf.Runtime.AllowedModules()
+	if err != nil {
+		return nil, fmt.Errorf("allowing modules: %w", err)
+	}
+
+	if limits := conf.Runtime.Limits(); limits != (runtime.Limits{}) {
+		slog.Info("Limiting resources of runs", slog.String("cgroup", conf.Runtime.Cgroup), slog.Any("limits", limits))
+	}
+
+	if conf.Runtime.Namespaces {
+		slog.Info("Isolating runs in namespaces")
+	}
+	if conf.Runtime.SeccompExec != "" {
+		slog.Info("Filtering syscalls of user programs", slog.String("profile", conf.Runtime.SeccompProfile))
+	}
+
+	if len(conf.Runtime.SlotUsers) == 0 && conf.Runtime.Slots > 1 {
+		slog.Warn("Runtime slots share a user, so their runs can access each other's files")
+	}
+
+	slots := make(chan Runtime, conf.Runtime.Slots)
+	for slot := range conf.Runtime.Slots {
+		run, err := createRuntime(conf, slot, cache, toolchains, modules, artifacts)
+		if err != nil {
+			return nil, fmt.Errorf("creating slot %d: %w", slot, err)
+		}
+		slots <- run
+	}
+
+	return slots, nil
 }
 
 // Function may panic due to invalid app configuration
-func createRuntime(conf Config, runtimeLock sync.Locker) (Runtime, error) {
+func createRuntime(
+	conf Config,
+	slot int,
+	cache *runtime.BuildCache,
+	toolchains *runtime.Toolchains,
+	modules *runtime.Modules,
+	artifacts *runtime.ArtifactStore,
+) (Runtime, error) {
+	username := conf.Runtime.SlotUser(slot)
+
+	env, err := createEnv(conf, username)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Runtime.Namespaces {
+		env = runtime.NewNamespaceEnv(env)
+	}
+
+	run := runtime.NewRuntime(&sync.Mutex{}, conf.Runtime.SlotDir(slot), env).
+		WithLimits(conf.Runtime.Cgroup, conf.Runtime.Limits()).
+		WithTimeout(conf.Runtime.Timeout).
+		WithOutputLimits(conf.Runtime.OutputLimits()).
+		WithToolchains(toolchains).
+		WithModules(modules).
+		WithBuildPolicy(conf.Runtime.BuildPolicy()).
+		WithEnvironment(conf.Runtime.Environment()).
+		WithSessionLimits(conf.Runtime.SessionLimits()).
+		WithWasmLimit(conf.Runtime.WasmMax).
+		WithCoverLimit(conf.Runtime.CoverMax).
+		WithProfileLimit(conf.Runtime.ProfileMax)
+
+	if limits := conf.Runtime.ToolchainLimits(); limits != nil {
+		run = run.WithToolchainLimits(*limits)
+	}
+
+	if cache != nil {
+		run = run.WithCache(cache)
+	}
+
+	if artifacts != nil {
+		// Validated when creating the config
+		platforms, _ := conf.Runtime.Platforms()
+		run = run.WithArtifacts(artifacts, platforms)
+	}
+
+	if conf.Runtime.SeccompExec != "" {
+		// Validated when creating the config
+		profile, _ := seccomp.ParseProfile(conf.Runtime.SeccompProfile)
+		run = run.WithSeccomp(conf.Runtime.SeccompExec, profile)
+	}
+
+	if username != nil {
+		owner, err := user.Lookup(*username)
+		if err != nil {
+			return nil, fmt.Errorf("looking up %s: %w", *username, err)
+		}
+
+		uid, err := strconv.Atoi(owner.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("parsing uid of %s: %w", *username, err)
+		}
+		gid, err := strconv.Atoi(owner.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("parsing gid of %s: %w", *username, err)
+		}
+
+		run = run.WithOwner(uid, gid)
+	}
+
+	return run, nil
+}
+
+func createEnv(conf Config, username *string) (runtime.SafeEnvProvider, error) {
 	// Run as same user
-	if conf.Runtime.RunAs == nil {
+	if username == nil {
 		slog.Info("Creating same user environment")
 		env := userenv.SameUserEnv{}
 
 		if conf.Mode != "debug" {
 			return nil, fmt.Errorf("Not specifying user to run the application as is not allowed outside of debug mode")
 		}
-		return runtime.NewRuntime(runtimeLock, conf.Runtime.Dir, env), nil
+		return env, nil
 	}
 
 	if conf.Runtime.RunAsPass != nil {
 		slog.Warn("Password authentication for a user is not supported")
 	}
 
-	slog.Info("Creating environment for a different user", slog.String("runAs", *conf.Runtime.RunAs))
-	diffUserEnv, err := userenv.NewDiffUserEnv(*conf.Runtime.RunAs, nil)
+	slog.Info("Creating environment for a different user", slog.String("runAs", *username))
+	diffUserEnv, err := userenv.NewDiffUserEnv(*username, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return runtime.NewRuntime(runtimeLock, conf.Runtime.Dir, diffUserEnv), nil
+	return diffUserEnv, nil
 }
 
-func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, sendCh chan Resp) {
+// Publish responses, setting versions on each of them
+func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, versions Versions, sendCh chan Resp) {
 	ch, err := conn.Channel()
 	// Cannot continue operationg on an error of such level
 	checkFatal(err, "Obtaining a channel from MQ")
@@ -171,6 +721,7 @@ func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, sendCh
 			slog.Warn("Message production context cancelled")
 			return
 		case r := <-sendCh:
+			r.Versions = versions
 			marshalled, err := json.Marshal(r)
 			if err != nil {
 				slog.Error("Could not marshall message", slog.String("err", err.Error()), slog.Any("val", r))
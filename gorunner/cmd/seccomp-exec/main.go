@@ -0,0 +1,52 @@
+// Executes a program with a seccomp filter
+//
+// Usage: seccomp-exec [-profile deny|strict] -- program [args...]
+//
+// Runtimes start user programs through it, so that the toolchain itself is not filtered.
+// A program, that makes a forbidden syscall, is killed with SIGSYS
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/Marattttt/personal-page/gorunner/pkg/seccomp"
+)
+
+// Exit code, when the program could not be started, the same as the one of env
+const exitCannotRun = 126
+
+func main() {
+	profileName := flag.String("profile", string(seccomp.ProfileDeny), "syscalls to allow, deny or strict")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fail("no program to execute")
+	}
+
+	profile, err := seccomp.ParseProfile(*profileName)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	// Looked up before filtering, the lookup itself needs no extra syscalls, but errors are clearer
+	program, err := exec.LookPath(flag.Arg(0))
+	if err != nil {
+		fail(err.Error())
+	}
+
+	if err := seccomp.Install(profile); err != nil {
+		fail(err.Error())
+	}
+
+	err = syscall.Exec(program, flag.Args(), os.Environ())
+	fail(fmt.Sprintf("executing %s: %s", program, err))
+}
+
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, "seccomp-exec:", msg)
+	os.Exit(exitCannotRun)
+}
@@ -0,0 +1,258 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources of diagnostics, other than the compiler
+const (
+	SourceVet     = "vet"
+	SourceGofmt   = "gofmt"
+	SourceImports = "imports"
+)
+
+// Result of analyzing a submission without running it
+type AnalysisResult struct {
+	// Whether no problems were found
+	Clean       bool         `json:"clean"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Raw output of go vet
+	VetOutput []byte `json:"vetOutput,omitempty"`
+
+	TimeTook  time.Duration `json:"timeTook"`
+	TimedOut  bool          `json:"timedOut,omitempty"`
+	GoVersion string        `json:"goVersion,omitempty"`
+}
+
+// Check a submission with go vet, gofmt and the import policy, without executing it
+//
+// Only packages of the standard library, of the submission itself and of allowed modules may be imported.
+// Submissions, that import anything else, are not vetted, only the rejected imports are reported
+func (r Runtime) Analyze(ctx context.Context, files Files) (*AnalysisResult, error) {
+	if err := files.ValidateSources(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	// Vet builds the packages, so it would compile cgo and modules, that Run refuses to build
+	if diagnostics := checkImports(files, r.modules); len(diagnostics) > 0 {
+		res := &AnalysisResult{Diagnostics: diagnostics, TimeTook: time.Since(start)}
+		slog.Info("Rejected imports of user code", slog.Int("diagnostics", len(diagnostics)))
+		return res, nil
+	}
+
+	// Checks of single files do not need a toolchain
+	diagnostics := checkFormatting(files)
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.initEnvironment(ctx, toolchain, files); err != nil {
+		return nil, fmt.Errorf("creating environment: %w", err)
+	}
+	if err := r.own(); err != nil {
+		return nil, err
+	}
+
+	// Vet only analyzes code, so it is treated as a part of the toolchain
+	command := "cd " + shellQuote(r.root) + " && " + r.goCommand(toolchain) + " vet ./... < /dev/null"
+
+	ex, err := r.execute(ctx, command, execOptions{limitToolchain: true})
+	if err != nil {
+		return nil, err
+	}
+
+	vetOutput := append(ex.stdout, ex.stderr...)
+	for _, d := range parseDiagnostics(vetOutput, r.root) {
+		d.Source = SourceVet
+		diagnostics = append(diagnostics, d)
+	}
+
+	res := &AnalysisResult{
+		Clean:       len(diagnostics) == 0 && ex.exitCode == 0,
+		Diagnostics: diagnostics,
+		VetOutput:   vetOutput,
+
+		TimeTook:  time.Since(start),
+		TimedOut:  ex.timedOut,
+		GoVersion: toolchain.Version,
+	}
+
+	slog.Info("Finished analyzing user code", slog.Int("diagnostics", len(diagnostics)), slog.Duration("timeTook", res.TimeTook))
+
+	return res, nil
+}
+
+// Report go files, that are not formatted with gofmt or can not be parsed
+func checkFormatting(files Files) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, name := range sortedGoFiles(files) {
+		content := files[name]
+
+		formatted, err := format.Source([]byte(content))
+		if err != nil {
+			diagnostics = append(diagnostics, syntaxDiagnostics(name, err)...)
+			continue
+		}
+
+		if string(formatted) != content {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:    path.Clean(name),
+				Line:    firstDifferentLine(content, string(formatted)),
+				Message: "file is not formatted with gofmt",
+				Source:  SourceGofmt,
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// Report imports of packages, that are not in the standard library, the submission or allowed modules
+func checkImports(files Files, modules *Modules) []Diagnostic {
+	module := moduleName(files)
+
+	var diagnostics []Diagnostic
+
+	for _, imp := range parseImports(files) {
+		if allowedImport(imp.path, module, modules) {
+			continue
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			File:    imp.pos.Filename,
+			Line:    imp.pos.Line,
+			Column:  imp.pos.Column,
+			Message: fmt.Sprintf("import of %q is not allowed, only the standard library, packages of the submission and allowed modules can be used", imp.path),
+			Source:  SourceImports,
+		})
+	}
+
+	return diagnostics
+}
+
+// Import of a package by a go file
+type importSpec struct {
+	path string
+	pos  token.Position
+}
+
+// Imports of every go file of a submission, in order of file names
+//
+// Files, that can not be parsed, are skipped, they are reported by checkFormatting or the compiler
+func parseImports(files Files) []importSpec {
+	var imports []importSpec
+
+	for _, name := range sortedGoFiles(files) {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, path.Clean(name), files[name], parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+
+		for _, spec := range f.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			imports = append(imports, importSpec{path: importPath, pos: fset.Position(spec.Path.Pos())})
+		}
+	}
+
+	return imports
+}
+
+// Whether a package is in the standard library, in the module of the submission or in an allowed module
+func allowedImport(importPath string, module string, modules *Modules) bool {
+	if importPath == "C" {
+		return false
+	}
+	if importPath == module || strings.HasPrefix(importPath, module+"/") {
+		return true
+	}
+	if _, ok := modules.find(importPath); ok {
+		return true
+	}
+
+	// Only paths of the standard library have no dot in the first element
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+var moduleRe = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// Name of the submission's module, the one created for submissions without a go.mod otherwise
+func moduleName(files Files) string {
+	for name, content := range files {
+		if path.Clean(name) != "go.mod" {
+			continue
+		}
+		if match := moduleRe.FindStringSubmatch(content); match != nil {
+			return match[1]
+		}
+	}
+	return "gorunner"
+}
+
+// Turn an error of the go parser into diagnostics
+func syntaxDiagnostics(name string, err error) []Diagnostic {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return []Diagnostic{{File: path.Clean(name), Message: err.Error()}}
+	}
+
+	diagnostics := make([]Diagnostic, 0, len(list))
+	for _, e := range list {
+		diagnostics = append(diagnostics, Diagnostic{
+			File:    path.Clean(name),
+			Line:    e.Pos.Line,
+			Column:  e.Pos.Column,
+			Message: e.Msg,
+		})
+	}
+	return diagnostics
+}
+
+func sortedGoFiles(files Files) []string {
+	var names []string
+	for name := range files {
+		if strings.HasSuffix(name, ".go") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// 1-based number of the first line, that differs between a and b
+func firstDifferentLine(a string, b string) int {
+	linesA := strings.Split(a, "\n")
+	linesB := strings.Split(b, "\n")
+
+	for i := range min(len(linesA), len(linesB)) {
+		if linesA[i] != linesB[i] {
+			return i + 1
+		}
+	}
+	return min(len(linesA), len(linesB)) + 1
+}
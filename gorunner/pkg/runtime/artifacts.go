@@ -0,0 +1,341 @@
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Returned (wrapped) when a submission asks for a platform, that the runner does not build for
+	ErrPlatform = fmt.Errorf("%w: platform is not allowed", ErrInvalidSubmission)
+	// Returned (wrapped) when a download token is unknown or has expired
+	ErrUnknownArtifact = fmt.Errorf("%w: unknown artifact", ErrInvalidSubmission)
+)
+
+// A GOOS/GOARCH pair
+type Platform struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+}
+
+var platformRe = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9]+$`)
+
+// Parse a platform in the form of go tool dist list, e.g. linux/amd64
+func ParsePlatform(s string) (Platform, error) {
+	if !platformRe.MatchString(s) {
+		return Platform{}, fmt.Errorf("%w: %q is not a GOOS/GOARCH pair", ErrInvalidSubmission, s)
+	}
+
+	goos, goarch, _ := strings.Cut(s, "/")
+	return Platform{GOOS: goos, GOARCH: goarch}, nil
+}
+
+func (p Platform) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+// Variables of the go command in the form of NAME=value
+func (p Platform) env() []string {
+	return []string{"GOOS=" + p.GOOS, "GOARCH=" + p.GOARCH}
+}
+
+// Name of a downloaded binary, e.g. main-windows-amd64.exe
+func (p Platform) binaryName() string {
+	name := "main-" + p.GOOS + "-" + p.GOARCH
+	if p.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// A binary, that is kept for download
+type Artifact struct {
+	// Random and hard to guess, the only way to get the binary
+	Token string `json:"token"`
+	// File name for the download, e.g. main-linux-amd64
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Expires time.Time `json:"expires"`
+}
+
+// Limits of stored artifacts, zero sizes mean no limit
+type ArtifactLimits struct {
+	// Largest single binary in bytes, larger ones are rejected
+	Size int64
+	// Total size of stored binaries in bytes, the oldest ones are removed to fit it
+	Total int64
+	// How long a binary can be downloaded after it was built
+	TTL time.Duration
+}
+
+// Binaries built for download, each of them in a directory named after its token
+//
+// Expired binaries are removed whenever the store is used. Safe for concurrent use by multiple runtimes
+type ArtifactStore struct {
+	dir    string
+	limits ArtifactLimits
+
+	mu sync.Mutex
+}
+
+func NewArtifactStore(dir string, limits ArtifactLimits) (*ArtifactStore, error) {
+	if limits.TTL <= 0 {
+		return nil, fmt.Errorf("artifacts need a positive ttl, got %s", limits.TTL)
+	}
+	// Otherwise the largest binaries would be evicted right after being stored
+	if limits.Total > 0 && limits.Size > limits.Total {
+		return nil, fmt.Errorf("artifact size limit %d is larger than the total limit %d", limits.Size, limits.Total)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating artifact dir: %w", err)
+	}
+
+	return &ArtifactStore{dir: dir, limits: limits}, nil
+}
+
+var tokenRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Copy a binary from src into the store under a new token
+func (s *ArtifactStore) put(src string, platform Platform) (*Artifact, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("checking binary: %w", err)
+	}
+	if s.limits.Size > 0 && info.Size() > s.limits.Size {
+		return nil, fmt.Errorf("%w: binary is %d bytes, at most %d are allowed", ErrInvalidSubmission, info.Size(), s.limits.Size)
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("generating token: %w", err)
+	}
+
+	artifact := &Artifact{
+		Token: hex.EncodeToString(random),
+		Name:  platform.binaryName(),
+		Size:  info.Size(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy under a temporary name first, so that a partial binary is never downloaded
+	tmp := filepath.Join(s.dir, artifact.Token+".tmp")
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		return nil, fmt.Errorf("creating artifact dir: %w", err)
+	}
+	if err := copyFile(src, filepath.Join(tmp, artifact.Name), 0755); err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("copying binary: %w", err)
+	}
+
+	dir := filepath.Join(s.dir, artifact.Token)
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("renaming artifact dir: %w", err)
+	}
+
+	// Expiry is counted from the modification time of the directory
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("checking artifact dir: %w", err)
+	}
+	artifact.Expires = stat.ModTime().Add(s.limits.TTL)
+
+	return artifact, s.evict()
+}
+
+// Read a binary by its token, an unknown or expired token is an ErrUnknownArtifact
+func (s *ArtifactStore) Get(token string) (*Artifact, []byte, error) {
+	if !tokenRe.MatchString(token) {
+		return nil, nil, fmt.Errorf("%w: malformed token", ErrUnknownArtifact)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.evict(); err != nil {
+		return nil, nil, err
+	}
+
+	dir := filepath.Join(s.dir, token)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrUnknownArtifact
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing artifact dir: %w", err)
+	}
+	if len(entries) != 1 {
+		return nil, nil, fmt.Errorf("artifact %s has %d files", token, len(entries))
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("checking artifact dir: %w", err)
+	}
+
+	name := entries[0].Name()
+	binary, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading binary: %w", err)
+	}
+
+	return &Artifact{
+		Token:   token,
+		Name:    name,
+		Size:    int64(len(binary)),
+		Expires: info.ModTime().Add(s.limits.TTL),
+	}, binary, nil
+}
+
+// Remove expired artifacts, then the oldest ones, until the total size fits the limit
+func (s *ArtifactStore) evict() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("listing artifacts: %w", err)
+	}
+
+	type stored struct {
+		name     string
+		size     int64
+		modified time.Time
+	}
+
+	var (
+		artifacts []stored
+		total     int64
+	)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		// Temporary directories are still being written
+		if err != nil || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+
+		if time.Since(info.ModTime()) > s.limits.TTL {
+			if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+				return fmt.Errorf("removing expired %s: %w", entry.Name(), err)
+			}
+			slog.Debug("Removed expired artifact", slog.String("token", entry.Name()))
+			continue
+		}
+
+		size := dirSize(filepath.Join(s.dir, entry.Name()))
+		artifacts = append(artifacts, stored{name: entry.Name(), size: size, modified: info.ModTime()})
+		total += size
+	}
+
+	if s.limits.Total <= 0 {
+		return nil
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].modified.Before(artifacts[j].modified)
+	})
+
+	for _, artifact := range artifacts {
+		if total <= s.limits.Total {
+			break
+		}
+
+		if err := os.RemoveAll(filepath.Join(s.dir, artifact.name)); err != nil {
+			return fmt.Errorf("evicting %s: %w", artifact.name, err)
+		}
+		total -= artifact.size
+
+		slog.Debug("Evicted artifact", slog.String("token", artifact.name))
+	}
+
+	return nil
+}
+
+// Total size of files directly in dir
+func dirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// Build binaries for download into a store, for platforms from an allowlist
+func (r Runtime) WithArtifacts(store *ArtifactStore, platforms []Platform) Runtime {
+	r.artifacts = store
+	r.platforms = platforms
+	return r
+}
+
+// Cross-compile the main package of a submission for a platform with cgo disabled, keeping the binary for download
+//
+// Nothing is run, the binary is only referenced by RunResult.Artifact. A platform, that is not allowed, is an
+// ErrPlatform, and a binary larger than the limit of the store is an ErrInvalidSubmission
+func (r Runtime) BuildArtifact(ctx context.Context, files Files, platform Platform) (*RunResult, error) {
+	if r.artifacts == nil {
+		return nil, fmt.Errorf("%w: builds for download are disabled", ErrInvalidSubmission)
+	}
+	if !slices.Contains(r.platforms, platform) {
+		return nil, fmt.Errorf("%w: %s", ErrPlatform, platform)
+	}
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+	if rejected := rejectImports(files, r.modules); rejected != nil {
+		return &RunResult{Compile: rejected, ExitCode: rejected.ExitCode}, nil
+	}
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return nil, err
+	}
+
+	// Binaries have to run on machines without the C libraries of the runner
+	cgo := false
+	r.buildOptions.CGOEnabled = &cgo
+	r.target = &platform
+
+	compiled, cacheHit, err := r.build(ctx, toolchain, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compiled.Success {
+		slog.Info("Submission did not compile for download", slog.String("platform", platform.String()), slog.Any("diagnostics", compiled.Diagnostics))
+		return &RunResult{Compile: compiled, ExitCode: compiled.ExitCode}, nil
+	}
+
+	artifact, err := r.artifacts.put(filepath.Join(r.root, binaryName), platform)
+	if err != nil {
+		return nil, fmt.Errorf("storing artifact: %w", err)
+	}
+
+	slog.Info("Built user code for download", slog.String("platform", platform.String()), slog.Int64("bytes", artifact.Size))
+
+	return &RunResult{
+		Compile:   compiled,
+		CacheHit:  cacheHit,
+		GoVersion: toolchain.Version,
+		Artifact:  artifact,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Used when a submission does not set a benchtime, the same as the one of go test
+const defaultBenchtime = "1s"
+
+// Result of a single benchmark, as reported by go test -bench -benchmem
+type Benchmark struct {
+	// Import path of the package, e.g. gorunner
+	Package string `json:"package"`
+	// Name without the GOMAXPROCS suffix, e.g. BenchmarkSort/small
+	Name string `json:"name"`
+	// GOMAXPROCS during the benchmark
+	Procs int `json:"procs"`
+
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"nsPerOp"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
+}
+
+// Run benchmarks of every package of a submission, tests are not run
+//
+// Benchtime is either a duration, e.g. 500ms, or a number of iterations, e.g. 100x, an empty one
+// means 1s. Since every benchmark is run a few times to pick the amount of iterations, a duration
+// has to be shorter than the timeout of the runtime
+func (r Runtime) Bench(ctx context.Context, files Files, benchtime string) (*RunResult, error) {
+	if benchtime == "" {
+		benchtime = defaultBenchtime
+	}
+	if err := r.validateBenchtime(benchtime); err != nil {
+		return nil, err
+	}
+
+	res, err := r.goTest(ctx, files, "-run=^$", "-bench=.", "-benchmem", "-benchtime="+benchtime)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Benchmarks = parseBenchmarks(res.Stdout)
+
+	slog.Info("Finished benchmarking user code", slog.Int("benchmarks", len(res.Benchmarks)), slog.Duration("timeTook", res.TimeTook))
+
+	return res, nil
+}
+
+var iterationsRe = regexp.MustCompile(`^[1-9]\d*x$`)
+
+func (r Runtime) validateBenchtime(benchtime string) error {
+	if iterationsRe.MatchString(benchtime) {
+		return nil
+	}
+
+	d, err := time.ParseDuration(benchtime)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("%w: benchtime %q is neither a duration nor a number of iterations, e.g. 1s or 100x", ErrInvalidSubmission, benchtime)
+	}
+	if r.timeout > 0 && d >= r.timeout {
+		return fmt.Errorf("%w: benchtime %s is not shorter than the timeout %s", ErrInvalidSubmission, d, r.timeout)
+	}
+
+	return nil
+}
+
+// BenchmarkName-8   1000   1234 ns/op   56 B/op   7 allocs/op, the name is omitted by some versions of go test
+var benchLineRe = regexp.MustCompile(`^(Benchmark\S*)?\s+(\d+)\s+(.*\d.* ns/op.*)$`)
+
+// Collect benchmark results from a go test -json stream
+//
+// Lines, that are not events, are skipped, so that a stream cut short by output limits is still reported
+func parseBenchmarks(stream []byte) []Benchmark {
+	var benchmarks []Benchmark
+
+	for _, line := range bytes.Split(stream, []byte("\n")) {
+		var ev testEvent
+		if err := json.Unmarshal(line, &ev); err != nil || ev.Action != "output" {
+			continue
+		}
+
+		match := benchLineRe.FindStringSubmatch(strings.TrimRight(ev.Output, "\n"))
+		if match == nil {
+			continue
+		}
+
+		name := match[1]
+		if name == "" {
+			name = ev.Test
+		}
+
+		b := Benchmark{Package: ev.Package, Name: name, Procs: 1}
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if procs, err := strconv.Atoi(name[i+1:]); err == nil {
+				b.Name, b.Procs = name[:i], procs
+			}
+		}
+		b.Iterations, _ = strconv.ParseInt(match[2], 10, 64)
+
+		// Every metric is a value followed by its unit
+		for _, metric := range strings.Split(match[3], "\t") {
+			fields := strings.Fields(metric)
+			if len(fields) != 2 {
+				continue
+			}
+
+			switch fields[1] {
+			case "ns/op":
+				b.NsPerOp, _ = strconv.ParseFloat(fields[0], 64)
+			case "B/op":
+				b.BytesPerOp, _ = strconv.ParseInt(fields[0], 10, 64)
+			case "allocs/op":
+				b.AllocsPerOp, _ = strconv.ParseInt(fields[0], 10, 64)
+			}
+		}
+
+		benchmarks = append(benchmarks, b)
+	}
+
+	return benchmarks
+}
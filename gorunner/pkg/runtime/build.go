@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Returned (wrapped) when a submission asks for a build option, that the runner does not allow
+var ErrBuildOption = fmt.Errorf("%w: build option is not allowed", ErrInvalidSubmission)
+
+// Settings of go build, that a submission may choose, the zero value builds with defaults
+type BuildOptions struct {
+	// Build with the race detector, races are reported in RunResult.Races
+	Race bool `json:"race,omitempty"`
+	// Build tags, e.g. integration
+	Tags []string `json:"tags,omitempty"`
+	// Value of -gcflags, e.g. -N -l
+	GCFlags string `json:"gcflags,omitempty"`
+	// Value of CGO_ENABLED, nil to keep the one of the toolchain
+	CGOEnabled *bool `json:"cgoEnabled,omitempty"`
+	// Comma separated experiments, e.g. rangefunc
+	GOEXPERIMENT string `json:"goexperiment,omitempty"`
+}
+
+// Build options, that an operator allows submissions to use
+//
+// The zero value allows nothing but the defaults
+type BuildPolicy struct {
+	Race bool `json:"race"`
+	// Tags, that may be set in any combination
+	Tags []string `json:"tags"`
+	// Values of -gcflags, that may be used as a whole
+	GCFlags []string `json:"gcflags"`
+	// Whether cgo may be enabled, disabling it is always allowed
+	CGO bool `json:"cgo"`
+	// Experiments, that may be set in any combination
+	Experiments []string `json:"experiments"`
+}
+
+// Check that every option, that is set, is allowed, an error wraps ErrBuildOption
+func (p BuildPolicy) Check(opts BuildOptions) error {
+	if opts.Race && !p.Race {
+		return fmt.Errorf("%w: race detector", ErrBuildOption)
+	}
+
+	for _, tag := range opts.Tags {
+		if !slices.Contains(p.Tags, tag) {
+			return fmt.Errorf("%w: tag %q", ErrBuildOption, tag)
+		}
+	}
+
+	if opts.GCFlags != "" && !slices.Contains(p.GCFlags, opts.GCFlags) {
+		return fmt.Errorf("%w: gcflags %q", ErrBuildOption, opts.GCFlags)
+	}
+
+	if opts.CGOEnabled != nil && *opts.CGOEnabled && !p.CGO {
+		return fmt.Errorf("%w: cgo", ErrBuildOption)
+	}
+
+	for _, experiment := range opts.experiments() {
+		if !slices.Contains(p.Experiments, experiment) {
+			return fmt.Errorf("%w: experiment %q", ErrBuildOption, experiment)
+		}
+	}
+
+	return nil
+}
+
+func (o BuildOptions) experiments() []string {
+	if o.GOEXPERIMENT == "" {
+		return nil
+	}
+	return strings.Split(o.GOEXPERIMENT, ",")
+}
+
+// Flags of go build and go test
+func (o BuildOptions) flags() []string {
+	var flags []string
+	if o.Race {
+		flags = append(flags, "-race")
+	}
+	if len(o.Tags) > 0 {
+		flags = append(flags, "-tags="+strings.Join(o.Tags, ","))
+	}
+	if o.GCFlags != "" {
+		flags = append(flags, "-gcflags="+o.GCFlags)
+	}
+	return flags
+}
+
+// Variables of the go command in the form of NAME=value
+func (o BuildOptions) env() []string {
+	var env []string
+	if o.CGOEnabled != nil {
+		if *o.CGOEnabled {
+			env = append(env, "CGO_ENABLED=1")
+		} else {
+			env = append(env, "CGO_ENABLED=0")
+		}
+	}
+	if o.GOEXPERIMENT != "" {
+		env = append(env, "GOEXPERIMENT="+o.GOEXPERIMENT)
+	}
+	return env
+}
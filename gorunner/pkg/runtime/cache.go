@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compiled binaries of previous submissions
+//
+// Binaries are keyed by a hash of everything that affects a build, so identical submissions
+// are only compiled once. Least recently used binaries are evicted once the total size exceeds
+// the limit. Safe for concurrent use by multiple runtimes
+type BuildCache struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+func NewBuildCache(dir string, maxSize int64) (*BuildCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating build cache dir: %w", err)
+	}
+
+	return &BuildCache{dir: dir, maxSize: maxSize}, nil
+}
+
+// Copy a binary for key to dst, reporting whether it was present
+func (c *BuildCache) get(key string, dst string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	src := filepath.Join(c.dir, key)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err := copyFile(src, dst, 0755); err != nil {
+		return false, fmt.Errorf("restoring cached binary: %w", err)
+	}
+
+	// Modification time is used to find least recently used entries
+	now := time.Now()
+	if err := os.Chtimes(src, now, now); err != nil {
+		slog.Warn("Could not update cache entry time", slog.String("err", err.Error()))
+	}
+
+	return true, nil
+}
+
+// Store a binary from src under key, evicting old entries if needed
+func (c *BuildCache) put(key string, src string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Copy under a temporary name first, so no one ever sees a partial binary
+	tmp := filepath.Join(c.dir, key+".tmp")
+	if err := copyFile(src, tmp, 0755); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying binary: %w", err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(c.dir, key)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("renaming binary: %w", err)
+	}
+
+	return c.evict()
+}
+
+// Remove least recently used entries, until the total size fits the limit
+func (c *BuildCache) evict() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("listing cache: %w", err)
+	}
+
+	var (
+		infos []os.FileInfo
+		total int64
+	)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+		total += info.Size()
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		if total <= c.maxSize {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(c.dir, info.Name())); err != nil {
+			return fmt.Errorf("evicting %s: %w", info.Name(), err)
+		}
+		total -= info.Size()
+
+		slog.Debug("Evicted cached binary", slog.String("key", info.Name()))
+	}
+
+	return nil
+}
+
+// Hash of everything that affects the produced binary
+func buildKey(goVersion string, flags []string, files Files) string {
+	h := sha256.New()
+
+	// Every value is length-prefixed, so that different inputs never produce the same stream
+	write := func(s string) {
+		binary.Write(h, binary.LittleEndian, uint64(len(s)))
+		io.WriteString(h, s)
+	}
+
+	write(goVersion)
+	write(strings.Join(flags, "\x00"))
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		write(path.Clean(name))
+		write(files[name])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func copyFile(src string, dst string, perm os.FileMode) error {
+	from, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	to, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(to, from); err != nil {
+		to.Close()
+		return err
+	}
+
+	return to.Close()
+}
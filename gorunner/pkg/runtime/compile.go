@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the binary built from a submission, relative to the module root
+const binaryName = ".gorunner-main"
+
+// A single message reported by the go toolchain
+type Diagnostic struct {
+	// Path relative to the module root, empty for messages not tied to a file
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+
+	Message string `json:"message"`
+	// Tool, that reported the message, empty for the compiler
+	Source string `json:"source,omitempty"`
+}
+
+// Result of building a submission
+type CompileResult struct {
+	// Whether a binary was produced
+	Success     bool         `json:"success"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Raw output of the toolchain
+	Output []byte `json:"output,omitempty"`
+
+	ExitCode int           `json:"exitCode"`
+	TimeTook time.Duration `json:"timeTook"`
+	TimedOut bool          `json:"timedOut,omitempty"`
+}
+
+// file:line:col: message, column is optional
+var diagnosticRe = regexp.MustCompile(`^([^:\s][^:]*):(\d+)(?::(\d+))?: (.*)$`)
+
+// Parse output of go build or go vet into diagnostics
+//
+// Package headers ("# pkg") are skipped, indented lines are continuations of
+// the previous message, and other lines become diagnostics without a position
+func parseDiagnostics(output []byte, root string) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#"):
+			continue
+
+		case strings.HasPrefix(line, "\t") && len(diagnostics) > 0:
+			last := &diagnostics[len(diagnostics)-1]
+			last.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		// go vet prefixes type errors with its name
+		line = strings.TrimPrefix(line, "vet: ")
+
+		match := diagnosticRe.FindStringSubmatch(line)
+		if match == nil {
+			diagnostics = append(diagnostics, Diagnostic{Message: line})
+			continue
+		}
+
+		lineNo, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+
+		diagnostics = append(diagnostics, Diagnostic{
+			File:    relativeToRoot(match[1], root),
+			Line:    lineNo,
+			Column:  column,
+			Message: match[4],
+		})
+	}
+
+	return diagnostics
+}
+
+// Make a path reported by the toolchain relative to the module root
+func relativeToRoot(file string, root string) string {
+	file = strings.TrimPrefix(file, root+"/")
+	return strings.TrimPrefix(file, "./")
+}
@@ -0,0 +1,246 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Coverage profile of a test run, relative to the module root
+const coverName = ".gorunner-cover"
+
+// Lines of every file, that tests ran or did not run
+type CoverageReport struct {
+	// Share of statements, that ran, from 0 to 100
+	Percent float64 `json:"percent"`
+	// Sorted by path
+	Files []FileCoverage `json:"files"`
+}
+
+// Coverage of a single file
+//
+// Lines, that have no statements, e.g. comments, are in neither of the ranges
+type FileCoverage struct {
+	// Path relative to the module root, the same as in the submission
+	File      string      `json:"file"`
+	Covered   []LineRange `json:"covered"`
+	Uncovered []LineRange `json:"uncovered"`
+}
+
+// Lines from Start to End inclusive, starting from 1
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Reject coverage profiles larger than max bytes, 0 for no limit
+func (r Runtime) WithCoverLimit(max int64) Runtime {
+	r.coverLimit = max
+	return r
+}
+
+// Run tests of every package of a submission, reporting lines, that the tests ran, in RunResult.Coverage
+//
+// Coverage is not reported, when the tests could not be built
+func (r Runtime) Cover(ctx context.Context, files Files) (*RunResult, error) {
+	r.cover = true
+
+	res, err := r.goTest(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Coverage != nil {
+		slog.Info("Finished measuring coverage of user code", slog.Float64("percent", res.Coverage.Percent), slog.Duration("timeTook", res.TimeTook))
+	}
+
+	return res, nil
+}
+
+// Read the coverage profile written by go test, nil if it has no blocks, e.g. when tests could not be built
+func (r Runtime) readCoverage(files Files) (*CoverageReport, error) {
+	profile, err := readWritten(filepath.Join(r.root, coverName), r.coverLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading coverage profile: %w", err)
+	}
+	if profile == nil {
+		return nil, nil
+	}
+
+	report := parseCoverProfile(profile, files)
+	// Only the mode line is written, when the build fails
+	if len(report.Files) == 0 {
+		return nil, nil
+	}
+
+	return report, nil
+}
+
+// A block of a coverage profile, e.g. gorunner/main.go:5.13,7.2 1 1
+type coverBlock struct {
+	startLine  int
+	endLine    int
+	statements int
+	ran        bool
+}
+
+// Build a report from a coverage profile, files are used to turn import paths back into submitted paths
+//
+// Blocks of files, that are not a part of the submission, and malformed lines are skipped
+func parseCoverProfile(profile []byte, files Files) *CoverageReport {
+	// Every block is reported once per test binary, that includes it, so they are merged by position
+	blocks := make(map[string]map[string]*coverBlock)
+
+	scanner := bufio.NewScanner(bytes.NewReader(profile))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		file, block, position, ok := parseCoverLine(line, files)
+		if !ok {
+			continue
+		}
+
+		if blocks[file] == nil {
+			blocks[file] = make(map[string]*coverBlock)
+		}
+		if existing, ok := blocks[file][position]; ok {
+			existing.ran = existing.ran || block.ran
+		} else {
+			blocks[file][position] = &block
+		}
+	}
+
+	var (
+		report     CoverageReport
+		statements int
+		ran        int
+	)
+
+	for file, fileBlocks := range blocks {
+		// A line ran, if any of the blocks on it did
+		lines := make(map[int]bool)
+		for _, block := range fileBlocks {
+			statements += block.statements
+			if block.ran {
+				ran += block.statements
+			}
+
+			for line := block.startLine; line <= block.endLine; line++ {
+				lines[line] = lines[line] || block.ran
+			}
+		}
+
+		report.Files = append(report.Files, FileCoverage{
+			File:      file,
+			Covered:   lineRanges(lines, true),
+			Uncovered: lineRanges(lines, false),
+		})
+	}
+
+	slices.SortFunc(report.Files, func(a, b FileCoverage) int {
+		return strings.Compare(a.File, b.File)
+	})
+
+	if statements > 0 {
+		report.Percent = float64(ran) / float64(statements) * 100
+	}
+
+	return &report
+}
+
+// Parse a line of a profile into the submitted file, the block and the position of the block in the file
+func parseCoverLine(line string, files Files) (string, coverBlock, string, bool) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", coverBlock{}, "", false
+	}
+
+	file, ok := submittedFile(name, files)
+	if !ok {
+		return "", coverBlock{}, "", false
+	}
+
+	// 5.13,7.2 1 1
+	fields := strings.Fields(rest)
+	if len(fields) != 3 {
+		return "", coverBlock{}, "", false
+	}
+	start, end, ok := strings.Cut(fields[0], ",")
+	if !ok {
+		return "", coverBlock{}, "", false
+	}
+
+	var (
+		block coverBlock
+		err   error
+		count int
+	)
+	startLine, _, _ := strings.Cut(start, ".")
+	endLine, endCol, _ := strings.Cut(end, ".")
+	if block.startLine, err = strconv.Atoi(startLine); err != nil {
+		return "", coverBlock{}, "", false
+	}
+	if block.endLine, err = strconv.Atoi(endLine); err != nil {
+		return "", coverBlock{}, "", false
+	}
+	// The end column is exclusive, so a block, that ends at the start of a line, does not cover it
+	if endCol == "1" && block.endLine > block.startLine {
+		block.endLine--
+	}
+	if block.statements, err = strconv.Atoi(fields[1]); err != nil {
+		return "", coverBlock{}, "", false
+	}
+	if count, err = strconv.Atoi(fields[2]); err != nil {
+		return "", coverBlock{}, "", false
+	}
+	block.ran = count > 0
+
+	return file, block, fields[0], true
+}
+
+// Find the submitted file, that an import path in a profile, e.g. gorunner/util/sum.go, refers to
+//
+// The longest matching path wins, so that util/main.go is not mistaken for main.go
+func submittedFile(importPath string, files Files) (string, bool) {
+	var match string
+	for name := range files {
+		cleaned := path.Clean(name)
+		if (importPath == cleaned || strings.HasSuffix(importPath, "/"+cleaned)) && len(cleaned) > len(match) {
+			match = cleaned
+		}
+	}
+
+	return match, match != ""
+}
+
+// Sorted ranges of consecutive lines, that either ran or did not
+func lineRanges(lines map[int]bool, ran bool) []LineRange {
+	var numbers []int
+	for line, lineRan := range lines {
+		if lineRan == ran {
+			numbers = append(numbers, line)
+		}
+	}
+	slices.Sort(numbers)
+
+	var ranges []LineRange
+	for _, line := range numbers {
+		if last := len(ranges) - 1; last >= 0 && ranges[last].End == line-1 {
+			ranges[last].End = line
+		} else {
+			ranges = append(ranges, LineRange{Start: line, End: line})
+		}
+	}
+
+	return ranges
+}
@@ -0,0 +1,266 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long outputs are still read after every process of a run was killed
+//
+// Processes that escaped the process group (and the cgroup, when there is none)
+// may keep the pipes open indefinitely
+const drainTimeout = time.Second
+
+// Result of a single command line executed in a logged in shell
+type execResult struct {
+	stdout []byte
+	stderr []byte
+
+	stdoutTruncated bool
+	stderrTruncated bool
+
+	exitCode int
+	timeTook time.Duration
+
+	timedOut     bool
+	limitHit     string
+	cpuThrottled bool
+	// Whether the shell, or a program it was replaced with, was killed with SIGSYS, e.g. by a seccomp filter
+	killedBySIGSYS bool
+	// Whether the run was killed after its idle timer expired
+	idleTimedOut bool
+}
+
+// Settings of a single execute call
+type execOptions struct {
+	// Apply resource limits of user programs
+	limitResources bool
+	// Apply resource limits of the toolchain, which builds and inspects user code
+	limitToolchain bool
+	// Called with output while the command runs, nil for none
+	onOutput func(OutputChunk)
+	// Kills the run once it expires, nil for none
+	idle *idleTimer
+}
+
+// Execute a command line in a logged in shell, applying the runtime's timeout and limits
+//
+// The shell is started in a new session, and after it exits every process left in its
+// process group (or cgroup) is killed, so nothing started by a run outlives it
+func (r Runtime) execute(ctx context.Context, command string, opts execOptions) (*execResult, error) {
+	runCtx := ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	cmd, err := r.env.Login(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+
+	cmd.Stdin = strings.NewReader(command)
+	slog.Debug("Prepared stdin for shell", slog.String("in", command))
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// Makes the shell a leader of a new process group, which is killed as a whole
+	cmd.SysProcAttr.Setsid = true
+
+	limits, limited := r.limits, opts.limitResources
+	if opts.limitToolchain {
+		limited = true
+		if r.toolchainLimits != nil {
+			limits = *r.toolchainLimits
+		}
+	}
+
+	var cg *cgroup
+	if limited && limits.enabled() {
+		cg, err = newCgroup(r.cgroupRoot, limits)
+		if err != nil {
+			return nil, fmt.Errorf("limiting resources: %w", err)
+		}
+		defer cg.remove()
+
+		cg.attach(cmd)
+	}
+
+	stdout, stderr, err := outPipes(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+
+	// There is no reason to keep running once output is discarded
+	output := newOutputCollector(r.outputLimits, func() {
+		slog.Warn("Run reached output limit, killing its processes")
+		killTree(cmd, cg)
+	})
+	output.onOutput = opts.onOutput
+
+	// For parallel reading of outpus during execution
+	var readWg sync.WaitGroup
+
+	slog.Info("Started execution", slog.String("cmd", cmd.String()))
+
+	// Command start time
+	start := time.Now()
+
+	err = cmd.Start()
+	// Write ends are only needed by the child, keeping them would prevent reading an EOF
+	cmd.Stdout.(*os.File).Close()
+	cmd.Stderr.(*os.File).Close()
+	if err != nil {
+		return nil, fmt.Errorf("starting shell: %w", err)
+	}
+
+	readWg.Add(2)
+	go readOutput(&readWg, stdout, &output.stdout, "stdout")
+	go readOutput(&readWg, stderr, &output.stderr, "stderr")
+
+	if cg != nil {
+		cg.watch()
+	}
+
+	// Kill the whole tree as soon as the deadline is reached, not only the shell
+	exited := make(chan struct{})
+	timedOut := make(chan bool, 1)
+	// Only read after receiving from timedOut
+	idleTimedOut := false
+	go func() {
+		select {
+		case <-runCtx.Done():
+			slog.Warn("Run was cancelled, killing its processes", slog.String("cause", runCtx.Err().Error()))
+			killTree(cmd, cg)
+			timedOut <- ctx.Err() == nil
+		case <-opts.idle.expired():
+			slog.Warn("Run was idle for too long, killing its processes")
+			idleTimedOut = true
+			killTree(cmd, cg)
+			timedOut <- false
+		case <-exited:
+			timedOut <- false
+		}
+	}()
+
+	waitErr := cmd.Wait()
+	close(exited)
+
+	// Background processes of the run must not survive it
+	killTree(cmd, cg)
+
+	stdout.SetReadDeadline(time.Now().Add(drainTimeout))
+	stderr.SetReadDeadline(time.Now().Add(drainTimeout))
+	readWg.Wait()
+
+	// Not the run's fault, e.g. the application is shutting down
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("run cancelled: %w", ctx.Err())
+	}
+
+	// An error other than exiterror indicates a system error
+	if waitErr != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(waitErr, &exitErr):
+			slog.Warn("Non-zero exitcode running user code", slog.Int("code", exitErr.ExitCode()))
+		case errors.Is(waitErr, context.DeadlineExceeded):
+			// Providers may create the command with the run's context, the timeout is reported separately
+		default:
+			return nil, fmt.Errorf("running cmd: %w", waitErr)
+		}
+	}
+
+	res := &execResult{
+		stdout: output.stdout.bytes(),
+		stderr: output.stderr.bytes(),
+
+		stdoutTruncated: output.stdout.isTruncated(),
+		stderrTruncated: output.stderr.isTruncated(),
+
+		exitCode: cmd.ProcessState.ExitCode(),
+		timeTook: time.Now().Sub(start),
+		timedOut: <-timedOut,
+
+		killedBySIGSYS: killedBySIGSYS(cmd.ProcessState),
+	}
+	res.idleTimedOut = idleTimedOut
+
+	if cg != nil {
+		cg.finish()
+		res.limitHit = cg.limitHit()
+		res.cpuThrottled = cg.throttled()
+	}
+
+	return res, nil
+}
+
+// Whether a process was killed with SIGSYS
+//
+// Shells and sudo report a signal of their child as an exit code of 128 + signal
+func killedBySIGSYS(state *os.ProcessState) bool {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal() == syscall.SIGSYS
+	}
+	return state.ExitCode() == 128+int(syscall.SIGSYS)
+}
+
+// Kill every process in the process group of cmd and in the cgroup, if there is one
+func killTree(cmd *exec.Cmd, cg *cgroup) {
+	// Negative pid means the whole process group
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		slog.Error("Could not kill process group", slog.Int("pgid", cmd.Process.Pid), slog.String("err", err.Error()))
+	}
+
+	if cg != nil {
+		cg.kill()
+	}
+}
+
+// Read from an output until EOF or until its read deadline
+func readOutput(wg *sync.WaitGroup, from *os.File, to io.Writer, name string) {
+	defer wg.Done()
+
+	_, err := io.Copy(to, from)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		slog.Warn("Stopped reading output held open after the run", slog.String("output", name))
+	} else if err != nil {
+		slog.Error("Error reading output", slog.String("output", name), slog.String("err", err.Error()))
+	}
+}
+
+// Create output pipes for a command and return their read ends (stdout, stderr)
+//
+// Unlike cmd.StdoutPipe, reading can finish independently of cmd.Wait, which is
+// needed to stop reading from processes that outlive the shell
+func outPipes(cmd *exec.Cmd) (*os.File, *os.File, error) {
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating stdout: %w", err)
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, nil, fmt.Errorf("creating stderr: %w", err)
+	}
+
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	return stdoutR, stderrR, nil
+}
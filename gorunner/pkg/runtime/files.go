@@ -0,0 +1,212 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Returned (wrapped) when a submission can not be run because of the submission itself,
+// as opposed to a failure of the runtime
+var ErrInvalidSubmission = errors.New("invalid submission")
+
+const (
+	// File that is required to be present in every submission
+	mainFile = "main.go"
+
+	// Limit on the amount of files in a single submission
+	maxFiles = 64
+)
+
+// Source tree of a submission
+//
+// Keys are slash-separated paths relative to the module root, e.g. "main.go", "util/util.go",
+// "static/index.html" or "go.mod". If no go.mod is provided, a module named "gorunner" is created,
+// so subpackages are imported as "gorunner/<dir>"
+type Files map[string]string
+
+// Check that every path is local to the directory it is written to, and that there is a main.go
+//
+// Absolute paths, paths with ".." elements and paths, that become the same after cleaning, are rejected
+func (f Files) Validate() error {
+	if err := f.validatePaths(); err != nil {
+		return err
+	}
+
+	if !f.has(func(name string) bool { return name == mainFile }) {
+		return fmt.Errorf("%w: %s is required", ErrInvalidSubmission, mainFile)
+	}
+
+	return nil
+}
+
+// Check paths like Validate, but require a test file instead of a main.go
+func (f Files) ValidateTests() error {
+	if err := f.validatePaths(); err != nil {
+		return err
+	}
+
+	if !f.has(func(name string) bool { return strings.HasSuffix(name, "_test.go") }) {
+		return fmt.Errorf("%w: at least one _test.go file is required", ErrInvalidSubmission)
+	}
+
+	return nil
+}
+
+// Check paths like Validate, but only require any go file
+func (f Files) ValidateSources() error {
+	if err := f.validatePaths(); err != nil {
+		return err
+	}
+
+	if !f.has(func(name string) bool { return strings.HasSuffix(name, ".go") }) {
+		return fmt.Errorf("%w: at least one .go file is required", ErrInvalidSubmission)
+	}
+
+	return nil
+}
+
+func (f Files) validatePaths() error {
+	if len(f) == 0 {
+		return fmt.Errorf("%w: no files provided", ErrInvalidSubmission)
+	}
+	if len(f) > maxFiles {
+		return fmt.Errorf("%w: too many files (%d), at most %d are allowed", ErrInvalidSubmission, len(f), maxFiles)
+	}
+
+	seen := make(map[string]string, len(f))
+
+	for name := range f {
+		cleaned := path.Clean(name)
+		if cleaned == "." {
+			return fmt.Errorf("%w: empty file path", ErrInvalidSubmission)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+			return fmt.Errorf("%w: path %q escapes the module root", ErrInvalidSubmission, name)
+		}
+
+		if cleaned == binaryName || cleaned == stdinName || cleaned == coverName ||
+			cleaned == cpuProfileName || cleaned == heapProfileName || cleaned == profileMainName ||
+			cleaned == sessionStdinName {
+			return fmt.Errorf("%w: %s is reserved", ErrInvalidSubmission, cleaned)
+		}
+
+		if other, ok := seen[cleaned]; ok {
+			return fmt.Errorf("%w: paths %q and %q point to the same file", ErrInvalidSubmission, name, other)
+		}
+		seen[cleaned] = name
+	}
+
+	// A file can not also be a directory of another one
+	for cleaned, name := range seen {
+		for dir := path.Dir(cleaned); dir != "."; dir = path.Dir(dir) {
+			if other, ok := seen[dir]; ok {
+				return fmt.Errorf("%w: path %q is inside of the file %q", ErrInvalidSubmission, name, other)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Whether a go.mod is a part of the submission
+func (f Files) hasGoMod() bool {
+	return f.has(func(name string) bool { return name == "go.mod" })
+}
+
+// Whether the cleaned path of any file matches
+func (f Files) has(match func(name string) bool) bool {
+	for name := range f {
+		if match(path.Clean(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write all files to root, creating intermediate directories
+//
+// Files must be validated before writing
+func (f Files) write(root string) error {
+	for name, content := range f {
+		dst := filepath.Join(root, filepath.FromSlash(path.Clean(name)))
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			return fmt.Errorf("creating parent of %s: %w", name, err)
+		}
+
+		// O_EXCL guarantees that nothing that is already present, e.g. a symlink, is followed
+		file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", name, err)
+		}
+
+		_, err = file.WriteString(content)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+
+		slog.Debug("Wrote file", slog.String("name", name), slog.Int("len", len(content)))
+	}
+
+	return nil
+}
+
+// Read a file, that user code was asked to write, nil if it is missing or not a regular file
+//
+// User code can put anything in its place, so symlinks are not followed and e.g. directories or fifos are skipped.
+// Files larger than max bytes are rejected, 0 for no limit
+func readWritten(name string, max int64) ([]byte, error) {
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checking %s: %w", filepath.Base(name), err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	// The file could have been replaced after the check, O_NONBLOCK keeps a fifo from blocking the open
+	file, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.ENXIO) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", filepath.Base(name), err)
+	}
+	defer file.Close()
+
+	if info, err = file.Stat(); err != nil {
+		return nil, fmt.Errorf("checking %s: %w", filepath.Base(name), err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	if max > 0 && info.Size() > max {
+		return nil, fmt.Errorf("%w: %s is %d bytes, at most %d are allowed", ErrInvalidSubmission, filepath.Base(name), info.Size(), max)
+	}
+
+	var reader io.Reader = file
+	// The file can still grow while it is read
+	if max > 0 {
+		reader = io.LimitReader(file, max+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(name), err)
+	}
+	if max > 0 && int64(len(content)) > max {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidSubmission, filepath.Base(name), max)
+	}
+	return content, nil
+}
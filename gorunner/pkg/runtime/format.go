@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"go/format"
+	"log/slog"
+)
+
+// Result of formatting a submission with gofmt
+type FormatResult struct {
+	// Source tree with go files formatted, other files and files with syntax errors are left as is
+	Files Files `json:"files"`
+	// Names of files, that were changed
+	Changed []string `json:"changed,omitempty"`
+	// Syntax errors of files, that could not be formatted
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Format go files of a submission the same way gofmt does
+//
+// Runs in-process, since formatting never executes or even type checks code.
+// Imports are not fixed, as that needs golang.org/x/tools, which the runner does not depend on
+func Format(files Files) (*FormatResult, error) {
+	if err := files.ValidateSources(); err != nil {
+		return nil, err
+	}
+
+	res := &FormatResult{Files: make(Files, len(files))}
+	for name, content := range files {
+		res.Files[name] = content
+	}
+
+	for _, name := range sortedGoFiles(files) {
+		formatted, err := format.Source([]byte(files[name]))
+		if err != nil {
+			res.Diagnostics = append(res.Diagnostics, syntaxDiagnostics(name, err)...)
+			continue
+		}
+
+		if string(formatted) != files[name] {
+			res.Files[name] = string(formatted)
+			res.Changed = append(res.Changed, name)
+		}
+	}
+
+	slog.Info("Formatted user code", slog.Int("changed", len(res.Changed)), slog.Int("diagnostics", len(res.Diagnostics)))
+
+	return res, nil
+}
@@ -0,0 +1,23 @@
+package runtime
+
+// Names of limits reported in RunResult.LimitHit
+const (
+	LimitMemory = "memory"
+	LimitPids   = "pids"
+)
+
+// Resource limits of a single run, enforced with a cgroup v2
+//
+// Zero values mean no limit
+type Limits struct {
+	// Maximum memory usage in bytes
+	Memory int64
+	// Amount of cpus the run may use, e.g. 0.5 for half of a single cpu
+	CPU float64
+	// Maximum amount of processes and threads
+	Pids int64
+}
+
+func (l Limits) enabled() bool {
+	return l.Memory > 0 || l.CPU > 0 || l.Pids > 0
+}
@@ -0,0 +1,164 @@
+package runtime
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// A third-party module, e.g. github.com/google/uuid@v1.6.0
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// Parse a module from path@version
+func ParseModule(s string) (Module, error) {
+	path, version, ok := strings.Cut(s, "@")
+	if !ok || path == "" || version == "" {
+		return Module{}, fmt.Errorf("%q is not in the path@version form", s)
+	}
+	return Module{Path: path, Version: version}, nil
+}
+
+func (m Module) String() string {
+	return m.Path + "@" + m.Version
+}
+
+// Third-party modules, that submissions are allowed to import
+//
+// Modules are served from a module cache, that is populated beforehand, e.g. with go mod download,
+// together with their dependencies. Builds never download anything, and the cache is only read,
+// so it should be readable, but not writable, by users that run submissions
+type Modules struct {
+	// GOMODCACHE of the builds
+	cacheDir string
+	modules  []Module
+}
+
+// Allow imports of modules, every one of which has to be present in the module cache at cacheDir
+func NewModules(cacheDir string, modules []Module) (*Modules, error) {
+	abs, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", cacheDir, err)
+	}
+
+	seen := make(map[string]bool, len(modules))
+	for _, m := range modules {
+		if seen[m.Path] {
+			return nil, fmt.Errorf("module %s is listed more than once", m.Path)
+		}
+		seen[m.Path] = true
+
+		zip := filepath.Join(abs, "cache", "download", escapeModulePath(m.Path), "@v", m.Version+".zip")
+		if _, err := os.Stat(zip); err != nil {
+			return nil, fmt.Errorf("module %s is not in the module cache: %w", m, err)
+		}
+
+		slog.Info("Allowed module", slog.String("module", m.String()))
+	}
+
+	return &Modules{cacheDir: abs, modules: slices.Clone(modules)}, nil
+}
+
+// Allowed module, that provides a package, nil modules allow nothing
+func (m *Modules) find(importPath string) (Module, bool) {
+	if m == nil {
+		return Module{}, false
+	}
+
+	var (
+		found Module
+		ok    bool
+	)
+	// Modules can be nested, e.g. golang.org/x/exp and golang.org/x/exp/typeparams, the longest path wins
+	for _, mod := range m.modules {
+		if importPath != mod.Path && !strings.HasPrefix(importPath, mod.Path+"/") {
+			continue
+		}
+		if !ok || len(mod.Path) > len(found.Path) {
+			found, ok = mod, true
+		}
+	}
+
+	return found, ok
+}
+
+// Allowed modules, that are imported by go files of a submission, sorted by path
+func (m *Modules) required(files Files) []Module {
+	var required []Module
+
+	for _, imp := range parseImports(files) {
+		mod, ok := m.find(imp.path)
+		if ok && !slices.Contains(required, mod) {
+			required = append(required, mod)
+		}
+	}
+
+	slices.SortFunc(required, func(a, b Module) int { return strings.Compare(a.Path, b.Path) })
+	return required
+}
+
+// Start of a shell command line, that configures go to only use the module cache
+//
+// Checksums are not verified, since the cache is populated by the operator
+func (m *Modules) env() string {
+	if m == nil {
+		return ""
+	}
+	return "GOPROXY=off GOSUMDB=off GOFLAGS=-mod=mod GOMODCACHE=" + shellQuote(m.cacheDir) + " "
+}
+
+// Add a require line to the go.mod in root for every module in required, that is not mentioned in it yet
+func addRequires(root string, required []Module) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	goMod := filepath.Join(root, "go.mod")
+
+	content, err := os.ReadFile(goMod)
+	if err != nil {
+		return fmt.Errorf("reading go.mod: %w", err)
+	}
+
+	var lines strings.Builder
+	for _, mod := range required {
+		// Requires written by the submission itself are kept as is
+		if slices.ContainsFunc(strings.Fields(string(content)), func(field string) bool { return field == mod.Path }) {
+			continue
+		}
+		lines.WriteString("require " + mod.Path + " " + mod.Version + "\n")
+	}
+	if lines.Len() == 0 {
+		return nil
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, "\n"+lines.String()...)
+
+	if err := os.WriteFile(goMod, content, 0666); err != nil {
+		return fmt.Errorf("writing go.mod: %w", err)
+	}
+
+	return nil
+}
+
+// Escape a module path the way the module cache does, see golang.org/x/mod/module.EscapePath
+func escapeModulePath(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			escaped.WriteRune('!')
+			r = unicode.ToLower(r)
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// Prepares the new namespaces and starts the provider's shell in them.
+// Runs with privileges of the runner, before the provider switches users
+const namespaceInit = `ip link set lo up && mount -t proc proc /proc && exec "$@"`
+
+// Provider, that starts shells of another provider in new network, pid, mount and ipc namespaces
+//
+// Runs can only reach other processes of the same run over loopback, so internal services,
+// e.g. the message broker or the database, are out of reach. Processes of the host are not
+// visible, and every process of a run is killed once its shell exits.
+// Requires CAP_SYS_ADMIN and the ip command
+type NamespaceEnv struct {
+	inner SafeEnvProvider
+}
+
+func NewNamespaceEnv(inner SafeEnvProvider) NamespaceEnv {
+	return NamespaceEnv{inner: inner}
+}
+
+func (n NamespaceEnv) Login(ctx context.Context) (*exec.Cmd, error) {
+	cmd, err := n.inner.Login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		return nil, fmt.Errorf("looking up sh: %w", err)
+	}
+
+	// The provider's command is started by the init script, with the same arguments
+	cmd.Args = append([]string{"sh", "-c", namespaceInit, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC
+	// Makes mounts of the run, e.g. its /proc, private to it
+	cmd.SysProcAttr.Unshareflags |= syscall.CLONE_NEWNS
+
+	return cmd, nil
+}
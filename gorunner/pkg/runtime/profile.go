@@ -0,0 +1,265 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Profiles written by a profiled run, relative to the module root
+	cpuProfileName  = ".gorunner-cpu.pprof"
+	heapProfileName = ".gorunner-heap.pprof"
+	// File added to the main package of a profiled run, it calls the submitted main between starting and writing profiles
+	profileMainName = "gorunner_profile.go"
+	// Name, that the submitted main is renamed to
+	profiledMain = "gorunnerProfiledMain"
+
+	// Bytes allocated between heap samples, small programs allocate too little for the default of 512KiB
+	memProfileRate = 4096
+	// Functions in the top table of a profile
+	profileTop = 20
+)
+
+// Profiles of a run, either of them is nil if the program did not write it, e.g. when it called os.Exit
+type ProfileReport struct {
+	CPU *Profile `json:"cpu,omitempty"`
+	// Allocations over the whole run, not only live memory at its end
+	Heap *Profile `json:"heap,omitempty"`
+}
+
+// A profile in the pprof format along with its functions, that cost the most
+type Profile struct {
+	// Can be opened with go tool pprof
+	Raw []byte `json:"raw"`
+	// Sorted by flat cost, at most profileTop of them
+	Top []ProfileEntry `json:"top"`
+}
+
+// A row of the top table of go tool pprof
+type ProfileEntry struct {
+	Function string `json:"function"`
+	// Cost of the function itself, e.g. 120ms or 1.50MB
+	Flat        string  `json:"flat"`
+	FlatPercent float64 `json:"flatPercent"`
+	// Cost of the function and everything it called
+	Cum        string  `json:"cum"`
+	CumPercent float64 `json:"cumPercent"`
+}
+
+// Run the main package of a submission with cpu and heap profiling, reporting profiles in RunResult.Profile
+//
+// The submitted main is renamed and called by a generated one, so programs, that exit with os.Exit or a panic,
+// are not profiled
+func (r Runtime) Profile(ctx context.Context, files Files, input Input) (*RunResult, error) {
+	r.profile = true
+
+	res, err := r.run(ctx, files, input, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Finished profiling user code", slog.Bool("profiled", res.Profile != nil), slog.Duration("timeTook", res.TimeTook))
+
+	return res, nil
+}
+
+// Run benchmarks of the package at the module root with cpu and heap profiling, reporting profiles in RunResult.Profile
+//
+// Benchmarks of other packages are not run, since go test profiles only a single package
+func (r Runtime) ProfileBench(ctx context.Context, files Files, benchtime string) (*RunResult, error) {
+	r.profile = true
+	return r.Bench(ctx, files, benchtime)
+}
+
+// Reject profiles larger than max bytes, 0 for no limit
+func (r Runtime) WithProfileLimit(max int64) Runtime {
+	r.profileLimit = max
+	return r
+}
+
+// Flags of go test, that write profiles of a package
+func profileFlags() []string {
+	return []string{
+		"-cpuprofile=" + cpuProfileName,
+		"-memprofile=" + heapProfileName,
+		"-memprofilerate=" + strconv.Itoa(memProfileRate),
+	}
+}
+
+// Source of the main function, that profiles the submitted one
+var profileMainCode = fmt.Sprintf(`package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+func main() {
+	runtime.MemProfileRate = %d
+
+	cpu, err := os.Create(%q)
+	if err != nil {
+		panic(err)
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		panic(err)
+	}
+
+	%s()
+
+	pprof.StopCPUProfile()
+	cpu.Close()
+
+	heap, err := os.Create(%q)
+	if err != nil {
+		panic(err)
+	}
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		panic(err)
+	}
+	heap.Close()
+}
+`, memProfileRate, cpuProfileName, profiledMain, heapProfileName)
+
+// Rename the main function of the package at the module root and add a main, that profiles it
+//
+// Files are returned unchanged, when there is no main function, so that the build fails as usual
+func wrapMain(files Files) Files {
+	for name, content := range files {
+		cleaned := path.Clean(name)
+		if strings.Contains(cleaned, "/") || !strings.HasSuffix(cleaned, ".go") || strings.HasSuffix(cleaned, "_test.go") {
+			continue
+		}
+
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, cleaned, content, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != "main" {
+			continue
+		}
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Name.Name != "main" {
+				continue
+			}
+
+			// Only the name changes, so positions of diagnostics stay the same, except for columns on its line
+			offset := fset.Position(fn.Name.Pos()).Offset
+			wrapped := make(Files, len(files)+1)
+			for name, content := range files {
+				wrapped[name] = content
+			}
+			wrapped[name] = content[:offset] + profiledMain + content[offset+len("main"):]
+			wrapped[profileMainName] = profileMainCode
+
+			return wrapped
+		}
+	}
+
+	return files
+}
+
+// Remove profiles of a previous run, which would otherwise be reported for a run, that did not write any
+func (r Runtime) removeProfiles() error {
+	for _, name := range []string{cpuProfileName, heapProfileName} {
+		// User code could also leave a directory in place of a profile
+		if err := os.RemoveAll(filepath.Join(r.root, name)); err != nil {
+			return fmt.Errorf("removing previous profile: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read the profiles written by a run along with their top tables, nil if there are none
+func (r Runtime) readProfiles(ctx context.Context, toolchain Toolchain) (*ProfileReport, error) {
+	cpu, err := r.readProfile(ctx, toolchain, cpuProfileName, "cpu")
+	if err != nil {
+		return nil, err
+	}
+	heap, err := r.readProfile(ctx, toolchain, heapProfileName, "alloc_space")
+	if err != nil {
+		return nil, err
+	}
+
+	if cpu == nil && heap == nil {
+		return nil, nil
+	}
+	return &ProfileReport{CPU: cpu, Heap: heap}, nil
+}
+
+// Read a profile and build its top table by a sample type with go tool pprof, nil if the profile was not written
+// or go tool pprof could not parse it
+func (r Runtime) readProfile(ctx context.Context, toolchain Toolchain, name string, sampleIndex string) (*Profile, error) {
+	raw, err := readWritten(filepath.Join(r.root, name), r.profileLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %w", err)
+	}
+	// The cpu profile is only written, once the profiler stops, which does not happen, when the program exits early
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	// Samples of the profiler itself, e.g. compressing the profile, are not a part of the program
+	command := "cd " + shellQuote(r.root) + " && " + r.goCommand(toolchain) + " tool pprof -top"
+	for _, arg := range []string{"-nodecount=" + strconv.Itoa(profileTop), "-sample_index=" + sampleIndex, "-ignore=runtime/pprof", name} {
+		command += " " + shellQuote(arg)
+	}
+
+	ex, err := r.execute(ctx, command, execOptions{limitToolchain: true})
+	if err != nil {
+		return nil, err
+	}
+	// User code can write anything in place of a profile, which is the same as not writing it
+	if ex.exitCode != 0 {
+		slog.Warn("Could not read a profile", slog.String("name", name), slog.String("stderr", string(ex.stderr)))
+		return nil, nil
+	}
+
+	return &Profile{Raw: raw, Top: parsePprofTop(ex.stdout)}, nil
+}
+
+// 680ms 98.55% 98.55% 690ms 100% main.work (inline)
+var pprofTopRe = regexp.MustCompile(`^\s*(\S+)\s+(\S+)%\s+\S+%\s+(\S+)\s+(\S+)%\s+(.+?)(?: \(inline\))?$`)
+
+// Collect rows of the output of go tool pprof -top, lines before the table header are skipped
+func parsePprofTop(output []byte) []ProfileEntry {
+	var (
+		entries []ProfileEntry
+		inTable bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inTable {
+			inTable = strings.HasPrefix(strings.TrimSpace(line), "flat ")
+			continue
+		}
+
+		match := pprofTopRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		entry := ProfileEntry{Flat: match[1], Cum: match[3], Function: match[5]}
+		entry.FlatPercent, _ = strconv.ParseFloat(match[2], 64)
+		entry.CumPercent, _ = strconv.ParseFloat(match[4], 64)
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
@@ -0,0 +1,132 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A data race found by the race detector
+type RaceReport struct {
+	// The access, that was detected, followed by the conflicting previous one
+	Accesses []RaceAccess `json:"accesses"`
+	// Where the goroutines, that made the accesses, were started
+	Goroutines []RaceGoroutine `json:"goroutines"`
+	// Text of the report as printed by the race detector
+	Output string `json:"output"`
+}
+
+type RaceAccess struct {
+	// e.g. Read, Write or Previous write
+	Kind    string `json:"kind"`
+	Address string `json:"address"`
+	// e.g. goroutine 7 or main goroutine
+	Goroutine string       `json:"goroutine"`
+	Stack     []StackFrame `json:"stack"`
+}
+
+type RaceGoroutine struct {
+	ID int `json:"id"`
+	// e.g. running or finished
+	State string `json:"state"`
+	// Stack of the go statement, that started the goroutine
+	CreatedAt []StackFrame `json:"createdAt"`
+}
+
+type StackFrame struct {
+	Function string `json:"function"`
+	// Relative to the module root for files of the submission
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+const (
+	raceHeader    = "WARNING: DATA RACE"
+	raceSeparator = "=================="
+)
+
+var (
+	raceAccessRe    = regexp.MustCompile(`^(.+) at (0x[0-9a-f]+) by (.+):$`)
+	raceGoroutineRe = regexp.MustCompile(`^Goroutine (\d+) \((.+)\) created at:$`)
+	frameLocationRe = regexp.MustCompile(`^(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// Collect reports of the race detector from output of a program or of go test
+//
+// A report, that was cut short by output limits, is still returned with what it has
+func parseRaces(output []byte, root string) []RaceReport {
+	var races []RaceReport
+
+	// Report being parsed, nil outside of one
+	var race *RaceReport
+	var raw strings.Builder
+	// Stack, that the next frames are added to
+	var stack *[]StackFrame
+	// Function of a frame, whose location is on the next line
+	var function string
+
+	finish := func() {
+		race.Output = raw.String()
+		races = append(races, *race)
+		race, stack = nil, nil
+		raw.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if race == nil {
+			if line == raceHeader {
+				race = &RaceReport{}
+				raw.WriteString(line + "\n")
+			}
+			continue
+		}
+
+		if line == raceSeparator {
+			finish()
+			continue
+		}
+		raw.WriteString(line + "\n")
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			stack, function = nil, ""
+
+		case !strings.HasPrefix(line, " "):
+			if match := raceGoroutineRe.FindStringSubmatch(line); match != nil {
+				id, _ := strconv.Atoi(match[1])
+				race.Goroutines = append(race.Goroutines, RaceGoroutine{ID: id, State: match[2]})
+				stack = &race.Goroutines[len(race.Goroutines)-1].CreatedAt
+			} else if match := raceAccessRe.FindStringSubmatch(line); match != nil {
+				race.Accesses = append(race.Accesses, RaceAccess{Kind: match[1], Address: match[2], Goroutine: match[3]})
+				stack = &race.Accesses[len(race.Accesses)-1].Stack
+			}
+
+		case stack == nil:
+			// Indented lines outside of stacks, e.g. of a mutex report, are only kept in the output
+
+		case function == "":
+			function = strings.TrimSuffix(trimmed, "()")
+
+		default:
+			frame := StackFrame{Function: function}
+			if match := frameLocationRe.FindStringSubmatch(trimmed); match != nil {
+				frame.File = relativeToRoot(match[1], root)
+				frame.Line, _ = strconv.Atoi(match[2])
+			}
+			*stack = append(*stack, frame)
+			function = ""
+		}
+	}
+
+	if race != nil {
+		finish()
+	}
+
+	return races
+}
@@ -1,10 +1,9 @@
 package runtime
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -12,15 +11,59 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/Marattttt/personal-page/gorunner/pkg/seccomp"
 )
 
 // Resut of running code
+//
+// When compilation fails, the program is not executed, and ExitCode is the one of the compiler
 type RunResult struct {
+	// Build phase, that precedes execution
+	Compile *CompileResult `json:"compile,omitempty"`
+
+	// Output of the program itself
 	Stdout []byte `json:"stdout"`
 	Stderr []byte `json:"stderr"`
+	// Whether outputs were cut short because of output limits
+	StdoutTruncated bool `json:"stdoutTruncated,omitempty"`
+	StderrTruncated bool `json:"stderrTruncated,omitempty"`
 
 	TimeTook time.Duration `json:"timeTook"`
 	ExitCode int           `json:"exitCode"`
+
+	// Whether the run was killed after reaching the runtime's timeout
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Resource limit, because of which the run was killed, if any
+	LimitHit string `json:"limitHit,omitempty"`
+	// Whether the run was slowed down by the cpu limit
+	CPUThrottled bool `json:"cpuThrottled,omitempty"`
+	// Whether the program was killed for a syscall, that the seccomp profile does not allow
+	SyscallBlocked bool `json:"syscallBlocked,omitempty"`
+
+	// Whether the binary was taken from the build cache instead of being compiled
+	CacheHit bool `json:"cacheHit,omitempty"`
+	// Version of the toolchain, that built the binary
+	GoVersion string `json:"goVersion,omitempty"`
+
+	// Results of go test, only set in test mode, in which case stdout is the raw go test -json stream
+	Tests *TestReport `json:"tests,omitempty"`
+	// Results of benchmarks, only set in bench mode
+	Benchmarks []Benchmark `json:"benchmarks,omitempty"`
+	// Data races, only reported when built with the race detector
+	Races []RaceReport `json:"races,omitempty"`
+
+	// Whether a session was stopped after going without input or output for too long
+	IdleTimedOut bool `json:"idleTimedOut,omitempty"`
+
+	// Program built for the browser, only set by wasm builds, which do not run anything
+	Wasm *WasmArtifact `json:"wasm,omitempty"`
+	// Binary kept for download, only set by cross-compiled builds, which do not run anything either
+	Artifact *Artifact `json:"artifact,omitempty"`
+	// Lines, that tests ran, only set in coverage mode
+	Coverage *CoverageReport `json:"coverage,omitempty"`
+	// Profiles of the program or benchmarks, only set in profiling mode
+	Profile *ProfileReport `json:"profile,omitempty"`
 }
 
 // Provides methods for managing a user-specific environment
@@ -38,133 +81,490 @@ type Runtime struct {
 	lck  sync.Locker
 	root string
 	env  SafeEnvProvider
+
+	limits Limits
+	// Limits of the toolchain, that builds and inspects submissions, nil for the limits of runs
+	toolchainLimits *Limits
+	// Parent cgroup, under which a cgroup for every run is created
+	cgroupRoot string
+	// Wall-clock limit of a single run, 0 for none
+	timeout time.Duration
+	// Limits of kept output, the run is stopped once they are reached
+	outputLimits OutputLimits
+	// Binaries of previous builds, nil for no caching
+	cache *BuildCache
+	// User, that is given exclusive access to the run directory, nil to leave it open to everyone
+	owner *dirOwner
+
+	// Installed toolchains, nil to use the one found in PATH
+	toolchains *Toolchains
+	// Toolchain chosen for a submission, nil for the default one
+	toolchain *Toolchain
+	// Third-party modules, that submissions may import, nil for none
+	modules *Modules
+	// Filter of syscalls of user programs, nil for none
+	seccomp *seccompExec
+	// Build options, that submissions may choose from
+	buildPolicy BuildPolicy
+	// Build options chosen for a submission
+	buildOptions BuildOptions
+	// Receives output of the program while it runs, nil for none
+	onOutput func(OutputChunk)
+	// Variables, that user programs start with
+	environment Environment
+	// Limits of interactive sessions
+	sessionLimits SessionLimits
+	// Platform, that builds target, nil for the one of the runner
+	target *Platform
+	// Largest wasm binary in bytes, that is returned, 0 for no limit
+	wasmLimit int64
+	// Largest coverage profile in bytes, that is read, 0 for no limit
+	coverLimit int64
+	// Largest cpu or heap profile in bytes, that is read, 0 for no limit
+	profileLimit int64
+	// Binaries built for download, nil when such builds are disabled
+	artifacts *ArtifactStore
+	// Platforms, that binaries for download may be built for
+	platforms []Platform
+	// Whether tests measure coverage
+	cover bool
+	// Whether programs and benchmarks are profiled
+	profile bool
+}
+
+type seccompExec struct {
+	// Path of the seccomp-exec helper
+	helper  string
+	profile seccomp.Profile
+}
+
+type dirOwner struct {
+	uid int
+	gid int
 }
 
 func NewRuntime(lck sync.Locker, runDir string, provider SafeEnvProvider) Runtime {
+	// The directory is accessed from a login shell, that does not share the working directory
+	if abs, err := filepath.Abs(runDir); err == nil {
+		runDir = abs
+	}
+
 	return Runtime{
 		lck:  lck,
 		env:  provider,
 		root: runDir,
+
+		environment: DefaultEnvironment(),
+	}
+}
+
+// Apply resource limits to every run through a cgroup v2 created under cgroupRoot
+func (r Runtime) WithLimits(cgroupRoot string, limits Limits) Runtime {
+	r.cgroupRoot = cgroupRoot
+	r.limits = limits
+	return r
+}
+
+// Apply different resource limits to the toolchain, e.g. larger ones, since the compiler needs more memory than most programs
+//
+// The cgroup root of WithLimits is used, without these the toolchain gets the limits of runs
+func (r Runtime) WithToolchainLimits(limits Limits) Runtime {
+	r.toolchainLimits = &limits
+	return r
+}
+
+// Kill every run, that takes longer than timeout, together with all of its processes
+func (r Runtime) WithTimeout(timeout time.Duration) Runtime {
+	r.timeout = timeout
+	return r
+}
+
+// Stop every run, that produces more output than limits allow
+func (r Runtime) WithOutputLimits(limits OutputLimits) Runtime {
+	r.outputLimits = limits
+	return r
+}
+
+// Give the user with uid and gid exclusive access to the run directory
+//
+// Should be the user that runs are executed as, so runtimes of different users cannot access each other's files
+func (r Runtime) WithOwner(uid int, gid int) Runtime {
+	r.owner = &dirOwner{uid: uid, gid: gid}
+	return r
+}
+
+// Reuse binaries of identical submissions, which may be shared between runtimes
+func (r Runtime) WithCache(cache *BuildCache) Runtime {
+	r.cache = cache
+	return r
+}
+
+// Build submissions with toolchains from a registry, the default one is used unless WithGoVersion is called
+func (r Runtime) WithToolchains(toolchains *Toolchains) Runtime {
+	r.toolchains = toolchains
+	r.toolchain = nil
+	return r
+}
+
+// Allow submissions to import modules from an offline module cache
+func (r Runtime) WithModules(modules *Modules) Runtime {
+	r.modules = modules
+	return r
+}
+
+// Start user programs, but not the toolchain, through the seccomp-exec helper with a profile
+//
+// Programs, that make a forbidden syscall, are killed and reported with RunResult.SyscallBlocked
+func (r Runtime) WithSeccomp(helper string, profile seccomp.Profile) Runtime {
+	r.seccomp = &seccompExec{helper: helper, profile: profile}
+	return r
+}
+
+// Allow submissions to choose build options
+func (r Runtime) WithBuildPolicy(policy BuildPolicy) Runtime {
+	r.buildPolicy = policy
+	return r
+}
+
+// Build submissions with options, that the build policy allows, otherwise an ErrBuildOption is returned
+func (r Runtime) WithBuildOptions(opts BuildOptions) (Runtime, error) {
+	if err := r.buildPolicy.Check(opts); err != nil {
+		return r, err
+	}
+
+	r.buildOptions = opts
+	return r, nil
+}
+
+// Start user programs with a base environment, which submissions can add to, except for protected variables
+//
+// Programs never inherit variables of the runner, without a base environment they start with none
+func (r Runtime) WithEnvironment(env Environment) Runtime {
+	r.environment = env
+	return r
+}
+
+// Pass output of the program to a handler while it runs, in addition to collecting it into RunResult
+//
+// Only run mode streams output. The handler is never called concurrently, and chunks come in order
+// of their numbers. A slow handler slows down the program, once the pipes of its outputs are full
+func (r Runtime) WithOutputHandler(handler func(OutputChunk)) Runtime {
+	r.onOutput = handler
+	return r
+}
+
+// Build submissions with a specific installed go version, e.g. go1.23.1
+//
+// An empty version means the default toolchain, and an unknown one is an ErrUnknownToolchain
+func (r Runtime) WithGoVersion(version string) (Runtime, error) {
+	toolchains, err := r.registry()
+	if err != nil {
+		return r, err
+	}
+
+	toolchain, err := toolchains.Get(version)
+	if err != nil {
+		return r, err
 	}
+
+	r.toolchain = &toolchain
+	return r, nil
 }
 
-// TODO: add support for extra files, e.g. through variable arguments
-func (r Runtime) Run(ctx context.Context, code string) (*RunResult, error) {
+// Run the main package of a submission without any input
+func (r Runtime) Run(ctx context.Context, files Files) (*RunResult, error) {
+	return r.RunWithInput(ctx, files, Input{})
+}
+
+// Run the main package of a submission with stdin and arguments
+func (r Runtime) RunWithInput(ctx context.Context, files Files, input Input) (*RunResult, error) {
+	return r.run(ctx, files, input, nil)
+}
+
+// Build and run the main package of a submission, with input written while it runs, if it is a session
+func (r Runtime) run(ctx context.Context, files Files, input Input, sess *session) (*RunResult, error) {
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	env, err := r.environment.merge(input.Env)
+	if err != nil {
+		return nil, err
+	}
+	if rejected := rejectImports(files, r.modules); rejected != nil {
+		return &RunResult{Compile: rejected, ExitCode: rejected.ExitCode}, nil
+	}
+	if r.profile {
+		files = wrapMain(files)
+	}
+
 	r.lck.Lock()
 	defer r.lck.Unlock()
 
-	if err := r.InitEnvironment(ctx, code); err != nil {
-		return nil, fmt.Errorf("creating environment: %w", err)
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return nil, err
 	}
 
-	cmd, err := r.env.Login(ctx)
+	compiled, cacheHit, err := r.build(ctx, toolchain, files)
 	if err != nil {
-		return nil, fmt.Errorf("logging in: %w", err)
+		return nil, err
 	}
 
-	goPath, err := goExecutableAbs(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("getting go path: %w", err)
+	if !compiled.Success {
+		slog.Info("Submission did not compile", slog.Any("diagnostics", compiled.Diagnostics))
+		return &RunResult{Compile: compiled, ExitCode: compiled.ExitCode}, nil
 	}
 
-	stdinStr := *goPath + " run " + r.root + "/main.go"
-	stdin := strings.NewReader(stdinStr)
-	cmd.Stdin = stdin
-	slog.Debug("Prepared stdin for shell", slog.String("in", stdinStr))
+	program := isolate(env, r.confine("./"+binaryName)...)
+	command := input.command(program...)
+	opts := execOptions{limitResources: true, onOutput: r.onOutput}
 
-	// Read all data from outputs, while the command is still running
-	stdout, stderr, err := getOutPipes(cmd)
+	if sess != nil {
+		if err := sess.start(r.root, input.Stdin); err != nil {
+			return nil, fmt.Errorf("starting session: %w", err)
+		}
+		defer sess.stop()
+
+		command = input.commandWithStdin(sessionStdinName, program...)
+		opts.onOutput = sess.onOutput(r.onOutput)
+		opts.idle = sess.idle
+	} else if err := input.writeStdin(r.root); err != nil {
+		return nil, err
+	}
+	if r.profile {
+		if err := r.removeProfiles(); err != nil {
+			return nil, err
+		}
+	}
+
+	ex, err := r.execute(ctx, "cd "+shellQuote(r.root)+" && "+command, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		// Final buffers to write output to
-		finStdout bytes.Buffer
-		// Final buffers to write output to
-		finStderr bytes.Buffer
+	res := &RunResult{
+		Compile: compiled,
 
-		// For parallel reading of outpus during execution
-		readWg sync.WaitGroup
-	)
+		Stderr:   ex.stderr,
+		Stdout:   ex.stdout,
+		ExitCode: ex.exitCode,
 
-	slog.Info("Started execution", slog.String("cmd", cmd.String()))
+		StdoutTruncated: ex.stdoutTruncated,
+		StderrTruncated: ex.stderrTruncated,
 
-	readWg.Add(1)
-	go func() {
-		defer readWg.Done()
-		b, err := io.ReadAll(stdout)
-		if err != nil {
-			slog.Error("Error reading stdout", slog.String("err", err.Error()))
-		} else {
-			finStdout.Write(b)
+		TimeTook: ex.timeTook,
+
+		TimedOut:       ex.timedOut,
+		LimitHit:       ex.limitHit,
+		CPUThrottled:   ex.cpuThrottled,
+		SyscallBlocked: r.seccomp != nil && ex.killedBySIGSYS,
+
+		CacheHit:  cacheHit,
+		GoVersion: toolchain.Version,
+
+		IdleTimedOut: ex.idleTimedOut,
+	}
+
+	if r.buildOptions.Race {
+		res.Races = parseRaces(ex.stderr, r.root)
+	}
+	if r.profile {
+		if res.Profile, err = r.readProfiles(ctx, toolchain); err != nil {
+			return nil, err
 		}
-	}()
+	}
+
+	slog.Debug("Finished running user code", slog.Any("result", res))
+	slog.Info("Finished running user code", slog.Any("result", res), slog.Duration("timeTook", res.TimeTook))
 
-	readWg.Add(1)
-	go func() {
-		defer readWg.Done()
-		b, err := io.ReadAll(stderr)
+	return res, nil
+}
+
+// Prepare the environment with a binary of the submission, reporting whether it came from the cache
+//
+// Only successful builds are cached, so failed ones are always compiled again
+func (r Runtime) build(ctx context.Context, toolchain Toolchain, files Files) (*CompileResult, bool, error) {
+	if r.cache == nil {
+		if err := r.initEnvironment(ctx, toolchain, files); err != nil {
+			return nil, false, fmt.Errorf("creating environment: %w", err)
+		}
+		if err := r.own(); err != nil {
+			return nil, false, err
+		}
+
+		compiled, err := r.compile(ctx, toolchain)
 		if err != nil {
-			slog.Error("Error reading stderr", slog.String("err", err.Error()))
-		} else {
-			finStderr.Write(b)
+			return nil, false, fmt.Errorf("compiling: %w", err)
 		}
-	}()
+		return compiled, false, nil
+	}
 
-	// Command start time
-	start := time.Now()
+	// Versions of allowed modules and the environment affect the binary just like build flags do
+	flags := append(r.buildArgs(), r.buildEnv()...)
+	for _, mod := range r.modules.required(files) {
+		flags = append(flags, "require="+mod.String())
+	}
+	key := buildKey(toolchain.Version, flags, files)
+
+	if err := r.writeFiles(files); err != nil {
+		return nil, false, fmt.Errorf("creating environment: %w", err)
+	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("starting shell: %w", err)
+	hit, err := r.cache.get(key, filepath.Join(r.root, binaryName))
+	if err != nil {
+		return nil, false, fmt.Errorf("reading build cache: %w", err)
+	}
+	if hit {
+		slog.Info("Using cached binary", slog.String("key", key))
+		return &CompileResult{Success: true}, true, r.own()
+	}
+
+	if err := r.initModule(ctx, toolchain, files); err != nil {
+		return nil, false, err
+	}
+	if err := r.own(); err != nil {
+		return nil, false, err
 	}
 
-	// Finish reading before comamnd completion, cannot be done other way round
-	readWg.Wait()
+	compiled, err := r.compile(ctx, toolchain)
+	if err != nil {
+		return nil, false, fmt.Errorf("compiling: %w", err)
+	}
 
-	// An error other than exiterror indicates a system error
-	if err := cmd.Wait(); err != nil {
-		exitErr, ok := err.(*exec.ExitError)
-		if ok {
-			slog.Warn("Non-zero exitcode running user code", slog.Int("code", exitErr.ExitCode()))
-		} else {
-			return nil, fmt.Errorf("running cmd: %w", err)
+	if compiled.Success {
+		// The run can go on without the cache, it is only slower next time
+		if err := r.cache.put(key, filepath.Join(r.root, binaryName)); err != nil {
+			slog.Error("Could not cache binary", slog.String("err", err.Error()))
 		}
 	}
 
-	res := &RunResult{
-		Stderr:   finStderr.Bytes(),
-		Stdout:   finStdout.Bytes(),
-		ExitCode: cmd.ProcessState.ExitCode(),
-		TimeTook: time.Now().Sub(start),
+	return compiled, false, nil
+}
+
+// Arguments of go build, every one of them affects the produced binary
+func (r Runtime) buildArgs() []string {
+	args := append([]string{"build", "-o", binaryName}, r.buildOptions.flags()...)
+	return append(args, ".")
+}
+
+// Variables of the go command in the form of NAME=value, every one of them affects the produced binary
+func (r Runtime) buildEnv() []string {
+	env := r.buildOptions.env()
+	if r.target != nil {
+		env = append(env, r.target.env()...)
 	}
+	return env
+}
 
-	slog.Debug("Finished running user code", slog.Any("result", res))
-	slog.Info("Finished running user code", slog.Any("result", res), slog.Duration("timeTook", time.Now().Sub(start)))
+// Build the prepared environment into a binary
+//
+// A failed build is not an error, its diagnostics are reported in the result instead
+func (r Runtime) compile(ctx context.Context, toolchain Toolchain) (*CompileResult, error) {
+	command := "cd " + shellQuote(r.root) + " && " + r.goCommand(toolchain)
+	for _, arg := range r.buildArgs() {
+		command += " " + shellQuote(arg)
+	}
 
-	return res, nil
+	ex, err := r.execute(ctx, command, execOptions{limitToolchain: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// go build does not write anything to stdout, but nothing should get lost
+	output := append(ex.stdout, ex.stderr...)
+
+	return &CompileResult{
+		Success:     ex.exitCode == 0 && !ex.timedOut,
+		Diagnostics: parseDiagnostics(output, r.root),
+		Output:      output,
+		ExitCode:    ex.exitCode,
+		TimeTook:    ex.timeTook,
+		TimedOut:    ex.timedOut,
+	}, nil
+}
+
+// Create a clean directory with the submitted files and a go.mod, if none was submitted
+func (r Runtime) InitEnvironment(ctx context.Context, files Files) error {
+	if err := files.Validate(); err != nil {
+		return err
+	}
+
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return err
+	}
+
+	return r.initEnvironment(ctx, toolchain, files)
 }
 
-// Create a clean directory with go.mod and main.go files
-func (r Runtime) InitEnvironment(ctx context.Context, code string) error {
+func (r Runtime) initEnvironment(ctx context.Context, toolchain Toolchain, files Files) error {
 	slog.Info("Started preparing runtime environment")
 
 	start := time.Now()
 
+	if err := r.writeFiles(files); err != nil {
+		return err
+	}
+
+	if err := r.initModule(ctx, toolchain, files); err != nil {
+		return err
+	}
+
+	slog.Info("Finished preparing runtime environment", slog.Duration("timeTook", time.Now().Sub(start)))
+
+	return nil
+}
+
+// Create a go.mod, if none was submitted, and require allowed modules, that are imported
+func (r Runtime) initModule(ctx context.Context, toolchain Toolchain, files Files) error {
+	if !files.hasGoMod() {
+		if err := goModInit(ctx, toolchain, r.root); err != nil {
+			return fmt.Errorf("go mod init: %w", err)
+		}
+	}
+
+	if err := addRequires(r.root, r.modules.required(files)); err != nil {
+		return fmt.Errorf("requiring modules: %w", err)
+	}
+
+	return nil
+}
+
+// Write validated files to a clean root directory
+func (r Runtime) writeFiles(files Files) error {
 	if err := clearDirectory(r.root); err != nil {
 		return fmt.Errorf("preparing root dir at %s: %w", r.root, err)
 	}
 
-	if err := goModInit(ctx, r.root); err != nil {
-		return fmt.Errorf("go mod init: %w", err)
+	if err := files.write(r.root); err != nil {
+		return fmt.Errorf("writing files: %w", err)
 	}
 
-	// Prepare a main.go file for running
-	if err := writeMain(r.root, code); err != nil {
-		return fmt.Errorf("writing main.go: %w", err)
+	return nil
+}
+
+// Hand the prepared run directory over to its owner, if there is one
+func (r Runtime) own() error {
+	if r.owner == nil {
+		return nil
 	}
 
-	slog.Info("Finished preparing runtime environment", slog.Duration("timeTook", time.Now().Sub(start)))
+	err := filepath.WalkDir(r.root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, r.owner.uid, r.owner.gid)
+	})
+	if err != nil {
+		return fmt.Errorf("changing owner of %s: %w", r.root, err)
+	}
+
+	if err := os.Chmod(r.root, 0700); err != nil {
+		return fmt.Errorf("restricting access to %s: %w", r.root, err)
+	}
 
 	return nil
 }
@@ -180,28 +580,11 @@ func clearDirectory(dir string) error {
 	return nil
 }
 
-// Get output pipes fro a comand (stdout, stderr)
-//
-// Pipesdo usually do not need to be closed manually, as they are autmoatically closed
-// when the comand exits
-func getOutPipes(cmd *exec.Cmd) (io.ReadCloser, io.ReadCloser, error) {
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting stdout: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting stderr: %w", err)
-	}
-
-	return stdout, stderr, nil
-}
-
 // Create go mod file in a directory
-func goModInit(ctx context.Context, dir string) error {
-	cmd := exec.CommandContext(ctx, "go", "mod", "init", "gorunner")
+func goModInit(ctx context.Context, toolchain Toolchain, dir string) error {
+	cmd := exec.CommandContext(ctx, toolchain.GoPath(), "mod", "init", "gorunner")
 	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
 
 	slog.Info("Creating go mod", slog.String("dir", dir))
 
@@ -218,29 +601,67 @@ func goModInit(ctx context.Context, dir string) error {
 	return nil
 }
 
-// Finds the absolute path to  go executable
-func goExecutableAbs(ctx context.Context) (*string, error) {
-	cmd := exec.CommandContext(ctx, "which", "go")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		slog.Warn("Could not get path of the go executable")
-		return nil, fmt.Errorf("running which go: %w", err)
+// Arguments, that start a user program with the seccomp filter, if there is one
+func (r Runtime) confine(program ...string) []string {
+	if r.seccomp == nil {
+		return program
+	}
+	return append([]string{r.seccomp.helper, "-profile", string(r.seccomp.profile), "--"}, program...)
+}
+
+// Start of a shell command line, that runs go with access to allowed modules and chosen build options
+func (r Runtime) goCommand(toolchain Toolchain) string {
+	command := r.modules.env()
+	for _, variable := range r.buildEnv() {
+		name, value, _ := strings.Cut(variable, "=")
+		command += name + "=" + shellQuote(value) + " "
+	}
+	return command + toolchain.command()
+}
+
+// Build result for a submission with disallowed imports, nil if all of them are allowed
+//
+// Such submissions are rejected before building, so that the reason is clear
+func rejectImports(files Files, modules *Modules) *CompileResult {
+	diagnostics := checkImports(files, modules)
+	if len(diagnostics) == 0 {
+		return nil
 	}
 
-	s := strings.TrimSpace(string(out))
-	return &s, nil
+	slog.Info("Rejected disallowed imports", slog.Any("diagnostics", diagnostics))
+
+	return &CompileResult{Diagnostics: diagnostics, ExitCode: 1}
 }
 
-func writeMain(root string, code string) error {
-	f, err := os.Create(filepath.Join(root, "main.go"))
+// Toolchain for the next build
+func (r Runtime) goToolchain() (Toolchain, error) {
+	if r.toolchain != nil {
+		return *r.toolchain, nil
+	}
+
+	toolchains, err := r.registry()
 	if err != nil {
-		return err
+		return Toolchain{}, err
 	}
-	defer f.Close()
 
-	f.Write([]byte(code))
+	return toolchains.Default(), nil
+}
 
-	slog.Debug("Wrote main.go", slog.String("content", code))
+// Toolchains, that submissions can choose from
+func (r Runtime) registry() (*Toolchains, error) {
+	if r.toolchains != nil {
+		return r.toolchains, nil
+	}
 
-	return nil
+	toolchains, err := pathToolchains()
+	if err != nil {
+		return nil, fmt.Errorf("detecting go toolchain: %w", err)
+	}
+
+	return toolchains, nil
+}
+
+// Quote a string to be passed to a posix shell as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
@@ -1,14 +1,26 @@
 package runtime
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 
 	"time"
 
 	"github.com/Marattttt/personal-page-libs/userenv"
+	"github.com/Marattttt/personal-page/gorunner/pkg/seccomp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,7 +45,7 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
 	defer cancel()
 
-	res, err := r.Run(ctx, code)
+	res, err := r.Run(ctx, Files{"main.go": code})
 
 	if assert.NoError(t, err, "A system error happened") {
 		assert.Equal(t, res.Stdout, expect.Stdout, "Should produce same stdout")
@@ -56,19 +68,2009 @@ func TestCouldNotCompile(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
 	defer cancel()
 
-	res, err := r.Run(ctx, code)
+	res, err := r.Run(ctx, Files{"main.go": code})
 
 	if assert.NoError(t, err, "A system error happened") {
 		assert.Equal(t, string(res.Stdout), "", "Nothing in stdout")
 		// go compiler always exits with 1 when invalid code is passed
 		assert.Equal(t, res.ExitCode, 1, "Should exit with 1")
 
-		// Strip the path prefix that is separated by a single space
-		// The +1 removes that space from the output
-		//
-		// example: invalid.go:1:1: expected 'package', found invalid
-		errMsg := string(res.Stderr)[bytes.IndexRune(res.Stderr, ' ')+1:]
+		if assert.NotNil(t, res.Compile, "Should report the build") {
+			assert.False(t, res.Compile.Success, "Should not compile")
+			assert.Equal(t, []Diagnostic{
+				{File: "main.go", Line: 1, Column: 1, Message: "expected 'package', found invalid"},
+			}, res.Compile.Diagnostics, "Error message from compiler")
+		}
+	}
+}
+
+func TestRuntimeErrorSeparateFromCompile(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "runtime failure")
+	os.Exit(3)
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+
+	if assert.NoError(t, err, "A system error happened") {
+		if assert.NotNil(t, res.Compile, "Should report the build") {
+			assert.True(t, res.Compile.Success, "Should compile")
+			assert.Empty(t, res.Compile.Diagnostics, "Should not report diagnostics")
+		}
+		assert.Equal(t, "runtime failure\n", string(res.Stderr), "Should only contain stderr of the program")
+		assert.Equal(t, 3, res.ExitCode, "Should report exit code of the program")
+	}
+}
+
+func TestMultipleFiles(t *testing.T) {
+	files := Files{
+		"main.go": `package main
+
+import (
+	_ "embed"
+	"fmt"
+
+	"example.com/multi/greet"
+)
+
+//go:embed name.txt
+var name string
+
+func main() {
+	fmt.Println(greet.Greet(name))
+}`,
+		"greet/greet.go": `package greet
+
+func Greet(name string) string {
+	return "Hello " + name
+}`,
+		"name.txt": "world",
+		"go.mod":   "module example.com/multi\n\ngo 1.21\n",
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, files)
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "Hello world\n", string(res.Stdout), "Should use the subpackage and embedded file")
+		assert.Equal(t, 0, res.ExitCode, "Should exit with 0")
+	}
+}
+
+func TestEscapingPaths(t *testing.T) {
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	for _, name := range []string{"../escaped.go", "/tmp/escaped.go", "sub/../../escaped.go", ""} {
+		files := Files{"main.go": "package main\nfunc main() {}", name: "package main"}
+
+		_, err := r.Run(context.Background(), files)
+
+		if assert.Error(t, err, "Path %q should be rejected", name) {
+			assert.True(t, errors.Is(err, ErrInvalidSubmission), "Should be reported as an invalid submission")
+		}
+	}
+
+	_, err := os.Stat("/tmp/gorunner/escaped.go")
+	assert.True(t, os.IsNotExist(err), "Nothing should be written outside of the root")
+
+	_, err = r.Run(context.Background(), Files{"main.go": "package main\nfunc main() {}", "x": "", "x/y/z.go": "package y"})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "A file inside of another file should be rejected")
+}
+
+func TestMemoryLimit(t *testing.T) {
+	const cgroupRoot = "/sys/fs/cgroup"
+	if controllers, err := os.ReadFile(cgroupRoot + "/cgroup.controllers"); err != nil || !strings.Contains(string(controllers), "memory") {
+		t.Skip("cgroup v2 memory controller is not available")
+	}
+
+	const code = `package main
+
+import "fmt"
+
+func main() {
+	var chunks [][]byte
+	for range 64 {
+		chunk := make([]byte, 32<<20)
+		for i := range chunk {
+			chunk[i] = 1
+		}
+		chunks = append(chunks, chunk)
+	}
+	fmt.Println(len(chunks))
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).
+			WithLimits(cgroupRoot+"/gorunner-test", Limits{Memory: 128 << 20}).
+			WithToolchainLimits(Limits{Memory: 1 << 30})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, LimitMemory, res.LimitHit, "Should report the memory limit")
+		assert.NotEqual(t, 0, res.ExitCode, "Should not exit successfully")
+		assert.Empty(t, res.Stdout, "Should be killed before printing")
+	}
+
+	// The compiler does not fit in a few megabytes
+	res, err = r.WithToolchainLimits(Limits{Memory: 4 << 20}).Run(ctx, Files{"main.go": code})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.Compile.Success, "The toolchain should be limited")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	const code = `package main
+
+func main() {
+	for {
+	}
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithTimeout(time.Second * 5)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	start := time.Now()
+	res, err := r.Run(ctx, Files{"main.go": code})
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.TimedOut, "Should be reported as timed out")
+		assert.NotEqual(t, 0, res.ExitCode, "Should not exit successfully")
+		assert.Less(t, time.Since(start), time.Second*10, "Should be killed shortly after the timeout")
+	}
+}
+
+func TestNoStrayProcesses(t *testing.T) {
+	// The background process keeps stdout open, which must not block the run either
+	const code = `package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func main() {
+	cmd := exec.Command("sleep", "31337")
+	cmd.Stdout = os.Stdout
+	if err := cmd.Start(); err != nil {
+		panic(err)
+	}
+	fmt.Println("started")
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithTimeout(time.Second * 15)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "started\n", string(res.Stdout), "Should produce stdout")
+		assert.False(t, res.TimedOut, "Should not wait for the background process")
+	}
+
+	assert.Empty(t, findProcesses(t, "sleep\x0031337"), "Background process should be killed")
+}
+
+// Pids of processes whose command line starts with prefix, arguments are separated by NUL
+func findProcesses(t *testing.T, prefix string) []string {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pids []string
+	for _, file := range cmdlines {
+		cmdline, err := os.ReadFile(file)
+		if err == nil && strings.HasPrefix(string(cmdline), prefix) {
+			pids = append(pids, filepath.Base(filepath.Dir(file)))
+		}
+	}
+
+	return pids
+}
+
+func TestOutputLimit(t *testing.T) {
+	const code = `package main
+
+import "fmt"
+
+func main() {
+	for {
+		fmt.Println("spam")
+	}
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).
+			WithTimeout(time.Second * 15).
+			WithOutputLimits(OutputLimits{Stream: 1000, Total: 1500})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Len(t, res.Stdout, 1000, "Should keep stdout up to the limit")
+		assert.True(t, res.StdoutTruncated, "Should report truncated stdout")
+		assert.False(t, res.StderrTruncated, "Should not report truncated stderr")
+		assert.False(t, res.TimedOut, "Should be stopped before the timeout")
+	}
+}
+
+func TestOutputHandler(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	fmt.Println("first")
+	time.Sleep(time.Second)
+	fmt.Fprintln(os.Stderr, "second")
+	fmt.Println("third")
+}`
+
+	var (
+		chunks  []OutputChunk
+		arrived []time.Time
+	)
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithOutputHandler(func(chunk OutputChunk) {
+			chunks = append(chunks, chunk)
+			arrived = append(arrived, time.Now())
+		})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+	finished := time.Now()
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotEmpty(t, chunks, "Output should be streamed") {
+		return
+	}
+
+	assert.Equal(t, OutputChunk{Stream: StreamStdout, Seq: 0, Data: []byte("first\n")}, chunks[0])
+	assert.Less(t, arrived[0], finished.Add(-time.Second/2), "Output should be passed on while the program runs")
+
+	var stdout, stderr []byte
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Seq, "Chunks should come in order")
+		if chunk.Stream == StreamStdout {
+			stdout = append(stdout, chunk.Data...)
+		} else {
+			stderr = append(stderr, chunk.Data...)
+		}
+	}
+	assert.Equal(t, res.Stdout, stdout, "Chunks should add up to the collected output")
+	assert.Equal(t, res.Stderr, stderr, "Chunks should add up to the collected output")
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	const output = `# gorunner
+./main.go:5:2: undefined: x
+/tmp/gorunner/test/util/util.go:3:9: cannot use s (variable of type string) as int value in return statement
+	have string
+	want int
+main.go:7: missing return
+vet: ./main.go:9:14: undefined: y
+go: some toolchain message
+`
+
+	expect := []Diagnostic{
+		{File: "main.go", Line: 5, Column: 2, Message: "undefined: x"},
+		{File: "util/util.go", Line: 3, Column: 9, Message: "cannot use s (variable of type string) as int value in return statement\nhave string\nwant int"},
+		{File: "main.go", Line: 7, Message: "missing return"},
+		{File: "main.go", Line: 9, Column: 14, Message: "undefined: y"},
+		{Message: "go: some toolchain message"},
+	}
+
+	assert.Equal(t, expect, parseDiagnostics([]byte(output), "/tmp/gorunner/test"))
+}
+
+func TestBuildCache(t *testing.T) {
+	const code = `package main
+import "fmt"
+
+func main() {
+	fmt.Println("Hello from cache")
+}`
+
+	cache, err := NewBuildCache(t.TempDir(), 1<<30)
+	if !assert.NoError(t, err, "Should create cache") {
+		return
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithCache(cache)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	first, err := r.Run(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	assert.False(t, first.CacheHit, "First run should be compiled")
+
+	second, err := r.Run(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	assert.True(t, second.CacheHit, "Identical submission should use the cache")
+	assert.Equal(t, first.Stdout, second.Stdout, "Cached binary should behave the same")
+
+	changed, err := r.Run(ctx, Files{"main.go": code, "extra.go": "package main"})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, changed.CacheHit, "Different sources should not use the cache")
+	}
+}
+
+func TestBuildCacheEviction(t *testing.T) {
+	var (
+		cacheDir = t.TempDir()
+		srcDir   = t.TempDir()
+		src      = filepath.Join(srcDir, "binary")
+	)
+
+	if !assert.NoError(t, os.WriteFile(src, make([]byte, 100), 0755)) {
+		return
+	}
+
+	// Room for two binaries
+	cache, err := NewBuildCache(cacheDir, 250)
+	if !assert.NoError(t, err, "Should create cache") {
+		return
+	}
+
+	for _, key := range []string{"a", "b"} {
+		assert.NoError(t, cache.put(key, src), "Should store a binary")
+	}
+
+	// Make a the most recently used entry
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(cacheDir, "b"), old, old))
+	hit, err := cache.get("a", filepath.Join(srcDir, "restored"))
+	assert.NoError(t, err)
+	assert.True(t, hit, "Should find a stored binary")
+
+	assert.NoError(t, cache.put("c", src), "Should store a binary")
+
+	for key, present := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, err := os.Stat(filepath.Join(cacheDir, key))
+		assert.Equal(t, present, err == nil, "Presence of %s after eviction", key)
+	}
+}
+
+func TestParallelRuntimes(t *testing.T) {
+	const code = `package main
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+//go:embed slot.txt
+var slot string
+
+func main() {
+	fmt.Print(slot)
+}`
+
+	env := userenv.SameUserEnv{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, slot := range []string{"a", "b", "c"} {
+		r := NewRuntime(&sync.Mutex{}, "/tmp/gorunner/test-slots/"+slot, env)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := r.Run(ctx, Files{"main.go": code, "slot.txt": slot})
+			if assert.NoError(t, err, "A system error happened") {
+				assert.Equal(t, slot, string(res.Stdout), "Should only see files of its own slot")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOwnedDirectory(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing owner of files requires root")
+	}
+
+	const nobody = 65534
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test-owned/"
+
+		r = NewRuntime(lck, dir, env).WithOwner(nobody, nobody)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	_, err := r.Run(ctx, Files{"main.go": "package main\nfunc main() {}"})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+
+	for _, name := range []string{"", "main.go", "go.mod"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if assert.NoError(t, err) {
+			stat := info.Sys().(*syscall.Stat_t)
+			assert.Equal(t, uint32(nobody), stat.Uid, "%s should belong to the owner", name)
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), "Only the owner should access the directory")
+	}
+}
+
+func TestStdinAndArgs(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	in, _ := io.ReadAll(os.Stdin)
+	fmt.Printf("%s|%s", strings.Join(os.Args[1:], ","), in)
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		input  Input
+		expect string
+	}{
+		{name: "No input", input: Input{}, expect: "|"},
+		{name: "Stdin", input: Input{Stdin: []byte("line 1\nline 2\n")}, expect: "|line 1\nline 2\n"},
+		{
+			name:   "Shell syntax in args",
+			input:  Input{Args: []string{"$(echo injected)", "; echo injected", "it's", "`id`", "a b"}},
+			expect: "$(echo injected),; echo injected,it's,`id`,a b|",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := r.RunWithInput(ctx, Files{"main.go": code}, test.input)
+			if assert.NoError(t, err, "A system error happened") {
+				assert.Equal(t, test.expect, string(res.Stdout), "Program should get exactly the input")
+				assert.Equal(t, 0, res.ExitCode)
+			}
+		})
+	}
+
+	_, err := r.RunWithInput(ctx, Files{"main.go": code}, Input{Args: []string{"a\x00b"}})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Null bytes can not be passed as arguments")
+}
+
+func TestSession(t *testing.T) {
+	const code = `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("name?")
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		fmt.Println("hello " + in.Text())
+	}
+	fmt.Println("bye")
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	t.Run("Input after output", func(t *testing.T) {
+		var (
+			stdin  = make(chan []byte)
+			output = make(chan string, 16)
+
+			r = NewRuntime(lck, dir, env).
+				WithSessionLimits(SessionLimits{Idle: 5 * time.Second}).
+				WithOutputHandler(func(chunk OutputChunk) { output <- string(chunk.Data) })
+		)
+
+		// Every line is only sent, once the answer to the previous one was printed
+		go func() {
+			defer close(stdin)
+			for _, line := range []string{"", "gopher", "world"} {
+				if line != "" {
+					stdin <- []byte(line + "\n")
+				}
+				select {
+				case <-output:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		res, err := r.RunSession(ctx, Files{"main.go": code}, Input{Stdin: []byte("first\n")}, stdin)
+		if assert.NoError(t, err, "A system error happened") {
+			assert.Equal(t, "name?\nhello first\nhello gopher\nhello world\nbye\n", string(res.Stdout), "Should read input written while running")
+			assert.Equal(t, 0, res.ExitCode)
+			assert.False(t, res.IdleTimedOut)
+		}
+	})
+
+	t.Run("Idle", func(t *testing.T) {
+		r := NewRuntime(lck, dir, env).WithSessionLimits(SessionLimits{Idle: 500 * time.Millisecond, Total: 10 * time.Second})
+
+		// Never written to or closed
+		stdin := make(chan []byte)
+
+		start := time.Now()
+		res, err := r.RunSession(ctx, Files{"main.go": code}, Input{}, stdin)
+		if assert.NoError(t, err, "A system error happened") {
+			assert.True(t, res.IdleTimedOut, "Session without input should be stopped")
+			assert.False(t, res.TimedOut, "Total timeout was not reached")
+			assert.NotEqual(t, 0, res.ExitCode)
+			assert.Less(t, time.Since(start), 8*time.Second)
+		}
+	})
+
+	t.Run("Total", func(t *testing.T) {
+		var (
+			r     = NewRuntime(lck, dir, env).WithSessionLimits(SessionLimits{Total: 2 * time.Second})
+			stdin = make(chan []byte)
+			done  = make(chan struct{})
+		)
+		defer close(done)
+
+		// Keeps the session active, so that only the total timeout stops it
+		go func() {
+			for {
+				select {
+				case stdin <- []byte("again\n"):
+					time.Sleep(100 * time.Millisecond)
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		res, err := r.RunSession(ctx, Files{"main.go": code}, Input{}, stdin)
+		if assert.NoError(t, err, "A system error happened") {
+			assert.True(t, res.TimedOut, "Session should be stopped after the total timeout")
+			assert.False(t, res.IdleTimedOut)
+		}
+	})
+
+	t.Run("Reserved", func(t *testing.T) {
+		r := NewRuntime(lck, dir, env)
+
+		_, err := r.RunSession(ctx, Files{"main.go": code, sessionStdinName: ""}, Input{}, make(chan []byte))
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "The stdin pipe of a session should be reserved")
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+func main() {
+	env := os.Environ()
+	slices.Sort(env)
+	for _, v := range env {
+		fmt.Println(v)
+	}
+}`
+
+	// Must not leak from the runner
+	t.Setenv("MQ_PASS", "secret")
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithEnvironment(Environment{
+			Base:      map[string]string{"PATH": "/usr/bin:/bin", "LANG": "C.UTF-8"},
+			Protected: []string{"PATH", "APP_*"},
+		})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.RunWithInput(ctx, Files{"main.go": code}, Input{Env: map[string]string{"TZ": "UTC", "LANG": "en_US.UTF-8"}})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "LANG=en_US.UTF-8\nPATH=/usr/bin:/bin\nTZ=UTC\n", string(res.Stdout), "Should start with only the base and submitted variables")
+	}
+
+	for _, vars := range []map[string]string{
+		{"PATH": "/tmp"},
+		{"APP_SECRET": "x"},
+		{"LD_PRELOAD": "/tmp/evil.so"},
+		{"A=B": "x"},
+		{"A": "\x00"},
+	} {
+		_, err := r.RunWithInput(ctx, Files{"main.go": code}, Input{Env: vars})
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "%v should be rejected", vars)
+	}
+
+	res, err = r.Test(ctx, Files{
+		"main.go":      code,
+		"main_test.go": "package main\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestEnv(t *testing.T) {\n\tif os.Getenv(\"MQ_PASS\") != \"\" || os.Getenv(\"LANG\") != \"C.UTF-8\" {\n\t\tt.Fatal(os.Environ())\n\t}\n}\n",
+	})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, 1, res.Tests.Passed, "Tests should start with only the base variables, got %s", res.Stdout)
+	}
+}
+
+func TestJoinExecArgs(t *testing.T) {
+	joined, err := joinExecArgs([]string{"env", "-i", "A=b c", `B=it's`, "", "/bin/helper"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `env -i 'A=b c' "B=it's" '' /bin/helper`, joined)
+	}
+
+	_, err = joinExecArgs([]string{`'"`})
+	assert.Error(t, err, "Both kinds of quotes can not be passed")
+}
+
+func TestToolchains(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	detected, err := DetectToolchains(ctx)
+	if !assert.NoError(t, err, "Should find go in PATH") {
+		return
+	}
+
+	def := detected.Default()
+	toolchains, err := NewToolchains(ctx, []string{def.GOROOT})
+	if !assert.NoError(t, err, "Should register a GOROOT") {
+		return
+	}
+
+	assert.Equal(t, []string{def.Version}, toolchains.Versions(), "Should list the installed version")
+
+	found, err := toolchains.Get(strings.TrimPrefix(def.Version, "go"))
+	if assert.NoError(t, err, "Version without the go prefix should be found") {
+		assert.Equal(t, def, found)
+	}
+
+	_, err = toolchains.Get("go1.0.0")
+	assert.ErrorIs(t, err, ErrUnknownToolchain, "Unknown version should not fall back to the default")
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Unknown version is the submission's fault")
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithToolchains(toolchains)
+	)
+
+	_, err = r.WithGoVersion("go1.0.0")
+	assert.ErrorIs(t, err, ErrUnknownToolchain, "Runtime should reject an unknown version")
+
+	r, err = r.WithGoVersion(def.Version)
+	if !assert.NoError(t, err, "Runtime should accept an installed version") {
+		return
+	}
+
+	res, err := r.Run(ctx, Files{"main.go": "package main\nfunc main() {}"})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, def.Version, res.GoVersion, "Should report the toolchain that built the binary")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	assert.NoError(t, r.SelfTest(ctx), "Should pass with a working toolchain")
+
+	// Builds, but can not be started
+	broken := r.WithSeccomp("/nonexistent/seccomp-exec", seccomp.ProfileDeny)
+	assert.Error(t, broken.SelfTest(ctx), "Should fail, when the program does not run")
+}
+
+func TestGoTest(t *testing.T) {
+	const (
+		sum = `package sum
+
+func Sum(a, b int) int { return a + b }`
+
+		tests = `package sum
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	if Sum(1, 2) != 3 {
+		t.Fatal("wrong sum")
+	}
+}
+
+func TestBroken(t *testing.T) {
+	t.Log("about to fail")
+	t.Fail()
+}
+
+func TestSkipped(t *testing.T) {
+	t.Skip("not today")
+}
+
+func TestTable(t *testing.T) {
+	t.Run("zero", func(t *testing.T) {})
+}`
+	)
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := r.Test(ctx, Files{"sum.go": sum, "sum_test.go": tests, "other/other.go": "package other"})
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotNil(t, res.Tests, "Should report tests") {
+		return
+	}
+
+	assert.Nil(t, res.Compile, "Everything should build")
+	assert.Equal(t, 1, res.ExitCode, "go test should fail with a failed test")
+	assert.Equal(t, 3, res.Tests.Passed, "TestSum, TestTable and its subtest should pass")
+	assert.Equal(t, 1, res.Tests.Failed)
+	assert.Equal(t, 1, res.Tests.Skipped)
+
+	statuses := make(map[string]string)
+	for _, pkg := range res.Tests.Packages {
+		statuses[pkg.Package] = pkg.Status
+		for _, test := range pkg.Tests {
+			statuses[test.Name] = test.Status
+			if test.Name == "TestBroken" {
+				assert.Contains(t, test.Output, "about to fail", "Should keep output of a test")
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"gorunner":       TestFail,
+		"gorunner/other": TestSkip,
+		"TestSum":        TestPass,
+		"TestBroken":     TestFail,
+		"TestSkipped":    TestSkip,
+		"TestTable":      TestPass,
+		"TestTable/zero": TestPass,
+	}, statuses)
+
+	res, err = r.Test(ctx, Files{"sum.go": sum, "sum_test.go": "package sum\nfunc TestX(t *testing.T) {}"})
+	if assert.NoError(t, err, "A system error happened") && assert.NotNil(t, res.Compile, "Should report the failed build") {
+		assert.NotEmpty(t, res.Compile.Diagnostics, "Should report why the tests did not build")
+		assert.Equal(t, "sum_test.go", res.Compile.Diagnostics[0].File)
+	}
+
+	_, err = r.Test(ctx, Files{"main.go": "package main\nfunc main() {}"})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Test mode requires test files")
+}
+
+func TestParseTestEvents(t *testing.T) {
+	// Build failure as reported by toolchains before go1.24, cut short by output limits
+	const stream = `{"Action":"start","Package":"gorunner"}
+{"Action":"output","Package":"gorunner","Output":"FAIL\tgorunner [build failed]\n"}
+{"Action":"fail","Package":"gorunner","Elapsed":0.5}
+{"Action":"start","Package":"gorunner/util"}
+{"Action":"run","Package":"gorunner/util","Test":"TestA"}
+{"Action":"output","Package":"gorunner/util","Test":"TestA","Outp`
+
+	report, buildOutput := parseTestEvents([]byte(stream))
+
+	assert.Empty(t, buildOutput, "Old toolchains do not emit build output events")
+	assert.Equal(t, []TestPackage{
+		{
+			Package:     "gorunner",
+			Status:      TestFail,
+			Elapsed:     500 * time.Millisecond,
+			Output:      "FAIL\tgorunner [build failed]\n",
+			BuildFailed: true,
+		},
+		{
+			Package: "gorunner/util",
+			Tests:   []TestCase{{Name: "TestA"}},
+		},
+	}, report.Packages)
+	assert.True(t, report.buildFailed())
+}
+
+func TestBench(t *testing.T) {
+	const (
+		join = `package join
+
+import "strings"
+
+func Join(parts []string) string { return strings.Join(parts, ",") }`
+
+		benchmarks = `package join
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotRun(t *testing.T) {
+	t.Fatal("tests should not run in bench mode")
+}
+
+func BenchmarkJoin(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Join([]string{"a", "b", "c"})
+	}
+}
+
+func BenchmarkSizes(b *testing.B) {
+	b.Run("small", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = make([]byte, 16)
+		}
+	})
+}
+
+func BenchmarkSlow(b *testing.B) {
+	if b.N > 100 {
+		time.Sleep(time.Minute)
+	}
+}`
+	)
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithTimeout(time.Second * 10)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := r.Bench(ctx, Files{"join.go": join, "join_test.go": benchmarks}, "100x")
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+
+	assert.Nil(t, res.Compile, "Everything should build")
+	assert.Equal(t, 0, res.ExitCode, "Benchmarks should pass, tests should not run")
+	if assert.Len(t, res.Benchmarks, 3, "Should report every benchmark and subbenchmark") {
+		names := []string{res.Benchmarks[0].Name, res.Benchmarks[1].Name, res.Benchmarks[2].Name}
+		assert.Equal(t, []string{"BenchmarkJoin", "BenchmarkSizes/small", "BenchmarkSlow"}, names)
+
+		assert.Equal(t, "gorunner", res.Benchmarks[0].Package)
+		assert.Equal(t, int64(100), res.Benchmarks[0].Iterations, "Should run the requested number of iterations")
+		assert.Greater(t, res.Benchmarks[0].NsPerOp, 0.0)
+		assert.Equal(t, int64(1), res.Benchmarks[0].AllocsPerOp, "strings.Join allocates the result once")
+		assert.Greater(t, res.Benchmarks[0].BytesPerOp, int64(0))
+	}
+
+	start := time.Now()
+	res, err = r.Bench(ctx, Files{"join.go": join, "join_test.go": benchmarks}, "1000x")
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.TimedOut, "Benchmarks should respect the timeout")
+		assert.Less(t, time.Since(start), time.Second*15, "Should be killed shortly after the timeout")
+	}
+
+	for _, benchtime := range []string{"10s", "1m", "0s", "x", "-1x", "fast"} {
+		_, err = r.Bench(ctx, Files{"join.go": join, "join_test.go": benchmarks}, benchtime)
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "Benchtime %q should be rejected", benchtime)
+	}
+}
+
+func TestParseBenchmarks(t *testing.T) {
+	// Results with GOMAXPROCS set, and with the name reported separately, cut short by output limits
+	const stream = `{"Action":"output","Package":"gorunner","Test":"BenchmarkA","Output":"BenchmarkA\n"}
+{"Action":"output","Package":"gorunner","Test":"BenchmarkA","Output":"BenchmarkA-8   \t 1000\t      12.5 ns/op\t       8 B/op\t       1 allocs/op\n"}
+{"Action":"output","Package":"gorunner","Test":"BenchmarkB/case","Output":"     200\t    5000 ns/op\n"}
+not an event
+{"Action":"output","Package":"gorunner","Test":"BenchmarkC","Output":"BenchmarkC-8 \t 10\t 1`
+
+	assert.Equal(t, []Benchmark{
+		{Package: "gorunner", Name: "BenchmarkA", Procs: 8, Iterations: 1000, NsPerOp: 12.5, BytesPerOp: 8, AllocsPerOp: 1},
+		{Package: "gorunner", Name: "BenchmarkB/case", Procs: 1, Iterations: 200, NsPerOp: 5000},
+	}, parseBenchmarks([]byte(stream)))
+}
+
+func TestBuildOptions(t *testing.T) {
+	const (
+		code = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(greeting)
+}`
+		plain = "//go:build !loud\n\npackage main\n\nconst greeting = \"hello\"\n"
+		loud  = "//go:build loud\n\npackage main\n\nconst greeting = \"HELLO\"\n"
+	)
+
+	cache, err := NewBuildCache(t.TempDir(), 1<<30)
+	if !assert.NoError(t, err, "Should create cache") {
+		return
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithCache(cache).WithBuildPolicy(BuildPolicy{Tags: []string{"loud"}})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	files := Files{"main.go": code, "plain.go": plain, "loud.go": loud}
+
+	res, err := r.Run(ctx, files)
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "hello\n", string(res.Stdout))
+	}
+
+	tagged, err := r.WithBuildOptions(BuildOptions{Tags: []string{"loud"}})
+	if !assert.NoError(t, err, "Allowed tag should be accepted") {
+		return
+	}
+
+	res, err = tagged.Run(ctx, files)
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.CacheHit, "Build options should be a part of the cache key")
+		assert.Equal(t, "HELLO\n", string(res.Stdout), "Tags should select files")
+	}
+
+	disallowed := []BuildOptions{
+		{Race: true},
+		{Tags: []string{"loud", "quiet"}},
+		{GCFlags: "-N -l"},
+		{CGOEnabled: new(bool)},
+		{GOEXPERIMENT: "rangefunc"},
+	}
+	*disallowed[3].CGOEnabled = true
+
+	for _, opts := range disallowed {
+		_, err := r.WithBuildOptions(opts)
+		assert.ErrorIs(t, err, ErrBuildOption, "%+v should not be allowed", opts)
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "Disallowed options are the submission's fault")
+	}
+
+	cgoDisabled := false
+	_, err = r.WithBuildOptions(BuildOptions{CGOEnabled: &cgoDisabled})
+	assert.NoError(t, err, "Disabling cgo should always be allowed")
+}
+
+func TestRaceDetector(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func main() {
+	var wg sync.WaitGroup
+	n := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n++
+		}()
+	}
+	wg.Wait()
+	fmt.Println(n)
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithBuildPolicy(BuildPolicy{Race: true})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	r, err := r.WithBuildOptions(BuildOptions{Race: true})
+	if !assert.NoError(t, err, "Race detector should be allowed") {
+		return
+	}
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") || !assert.True(t, res.Compile.Success, "Should build with -race") {
+		return
+	}
+
+	assert.Equal(t, 66, res.ExitCode, "The race detector exits with 66 after finding races")
+	if assert.Len(t, res.Races, 1) {
+		race := res.Races[0]
+		assert.Contains(t, race.Output, "WARNING: DATA RACE")
+		if assert.Len(t, race.Accesses, 2, "Should report both conflicting accesses") {
+			assert.Equal(t, []StackFrame{{Function: "main.main.func1", File: "main.go", Line: 15}}, race.Accesses[0].Stack)
+		}
+		if assert.NotEmpty(t, race.Goroutines) {
+			assert.Equal(t, "main.main", race.Goroutines[0].CreatedAt[0].Function)
+		}
+	}
+
+	res, err = r.Test(ctx, Files{
+		"main.go":      code,
+		"main_test.go": "package main\n\nimport \"testing\"\n\nfunc TestRace(t *testing.T) {\n\tmain()\n}\n",
+	})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Len(t, res.Races, 1, "Should report races found by tests")
+	}
+}
+
+func TestParseRaces(t *testing.T) {
+	// A complete report followed by one, that was cut short by output limits
+	const output = `before
+==================
+WARNING: DATA RACE
+Read at 0x00c000018188 by goroutine 8:
+  main.main.func1()
+      /run/main.go:15 +0x7b
+
+Previous write at 0x00c000018188 by main goroutine:
+  main.inc()
+      /run/util/inc.go:3 +0x8d
+  main.main()
+      /run/main.go:20 +0x8d
+
+Goroutine 8 (running) created at:
+  main.main()
+      /run/main.go:13 +0x7d
+==================
+==================
+WARNING: DATA RACE
+Write at 0x00c000018190 by goroutine 9:
+  main.main.func2()
+`
+
+	races := parseRaces([]byte(output), "/run")
+	if !assert.Len(t, races, 2) {
+		return
+	}
+
+	assert.Equal(t, []RaceAccess{
+		{
+			Kind:      "Read",
+			Address:   "0x00c000018188",
+			Goroutine: "goroutine 8",
+			Stack:     []StackFrame{{Function: "main.main.func1", File: "main.go", Line: 15}},
+		},
+		{
+			Kind:      "Previous write",
+			Address:   "0x00c000018188",
+			Goroutine: "main goroutine",
+			Stack: []StackFrame{
+				{Function: "main.inc", File: "util/inc.go", Line: 3},
+				{Function: "main.main", File: "main.go", Line: 20},
+			},
+		},
+	}, races[0].Accesses)
+	assert.Equal(t, []RaceGoroutine{
+		{ID: 8, State: "running", CreatedAt: []StackFrame{{Function: "main.main", File: "main.go", Line: 13}}},
+	}, races[0].Goroutines)
+	assert.True(t, strings.HasPrefix(races[0].Output, "WARNING: DATA RACE\n"))
+
+	assert.Equal(t, []RaceAccess{{Kind: "Write", Address: "0x00c000018190", Goroutine: "goroutine 9"}}, races[1].Accesses)
+}
+
+func TestAnalyze(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"gorunner/util"
+)
+
+func main() {
+    fmt.Printf("%d\n", "not a number")
+	fmt.Println(util.X)
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Analyze(ctx, Files{"main.go": code, "util/util.go": "package util\n\nconst X = 1\n"})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+
+	assert.False(t, res.Clean)
+
+	sources := make(map[string][]Diagnostic)
+	for _, d := range res.Diagnostics {
+		sources[d.Source] = append(sources[d.Source], d)
+	}
+
+	assert.Equal(t, []Diagnostic{
+		{File: "main.go", Line: 9, Message: "file is not formatted with gofmt", Source: SourceGofmt},
+	}, sources[SourceGofmt], "Should report the badly indented line")
+
+	assert.Empty(t, sources[SourceImports], "Packages of the submission are allowed")
+	assert.NotEmpty(t, sources[SourceVet], "Should report vet problems")
+
+	const disallowed = `package main
+
+import (
+	"C"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+func main() {
+    fmt.Printf("%d\n", "not a number")
+	fmt.Println(uuid.New())
+}`
+
+	res, err = r.Analyze(ctx, Files{"main.go": disallowed})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.Clean)
+		assert.Empty(t, res.VetOutput, "Code with disallowed imports should not be vetted")
+		if assert.Len(t, res.Diagnostics, 2, "Only the imports should be reported: %v", res.Diagnostics) {
+			assert.Equal(t, SourceImports, res.Diagnostics[0].Source)
+			assert.Equal(t, 4, res.Diagnostics[0].Line)
+			assert.Equal(t, 7, res.Diagnostics[1].Line)
+		}
+	}
+
+	const clean = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("clean")
+}
+`
+
+	res, err = r.Analyze(ctx, Files{"main.go": clean})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.Clean, "Clean code should have no diagnostics: %v", res.Diagnostics)
+	}
+
+	res, err = r.Analyze(ctx, Files{"main.go": "package main\nfunc main() {"})
+	if assert.NoError(t, err, "A system error happened") && assert.NotEmpty(t, res.Diagnostics) {
+		assert.Equal(t, Diagnostic{File: "main.go", Line: 2, Column: 14, Message: "expected '}', found 'EOF'"}, res.Diagnostics[0])
+	}
+}
+
+func TestFormat(t *testing.T) {
+	files := Files{
+		"main.go":      "package main\nfunc main() {\n    println(1)\n}\n",
+		"util/util.go": "package util\n\nconst X = 1\n",
+		"broken.go":    "package main\nfunc broken() {",
+		"go.mod":       "module gorunner\n",
+	}
+
+	res, err := Format(files)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "package main\n\nfunc main() {\n\tprintln(1)\n}\n", res.Files["main.go"])
+	assert.Equal(t, []string{"main.go"}, res.Changed, "Formatted files should not be reported as changed")
+	assert.Equal(t, files["broken.go"], res.Files["broken.go"], "Files with syntax errors should be left as is")
+	assert.Equal(t, files["go.mod"], res.Files["go.mod"])
+	assert.Equal(t, []Diagnostic{{File: "broken.go", Line: 2, Column: 16, Message: "expected '}', found 'EOF'"}}, res.Diagnostics)
+	assert.Contains(t, files["main.go"], "    println", "Input should not be modified")
+
+	_, err = Format(Files{"README.md": "hi"})
+	assert.ErrorIs(t, err, ErrInvalidSubmission)
+}
+
+func TestModules(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+
+	"example.com/greet"
+	"example.com/other"
+)
+
+func main() {
+	fmt.Println(greet.Hello(), other.X)
+}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	cacheDir := populateModuleCache(t, ctx, Module{Path: "example.com/greet", Version: "v1.0.0"}, map[string]string{
+		"go.mod":   "module example.com/greet\n\ngo 1.21\n",
+		"greet.go": "package greet\n\nfunc Hello() string { return \"Hello from a module\" }\n",
+	})
+
+	_, err := NewModules(cacheDir, []Module{{Path: "example.com/missing", Version: "v1.0.0"}})
+	assert.Error(t, err, "Modules missing from the cache should not be allowed")
+
+	modules, err := NewModules(cacheDir, []Module{{Path: "example.com/greet", Version: "v1.0.0"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithModules(modules)
+	)
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotNil(t, res.Compile) {
+		return
+	}
+	if assert.Len(t, res.Compile.Diagnostics, 1, "Only the module, that is not allowed, should be reported") {
+		assert.Equal(t, Diagnostic{
+			File:    "main.go",
+			Line:    7,
+			Column:  2,
+			Message: `import of "example.com/other" is not allowed, only the standard library, packages of the submission and allowed modules can be used`,
+			Source:  SourceImports,
+		}, res.Compile.Diagnostics[0])
+	}
+
+	allowed := strings.ReplaceAll(strings.ReplaceAll(code, "\t\"example.com/other\"\n", ""), ", other.X", "")
+
+	res, err = r.Run(ctx, Files{"main.go": allowed})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, 0, res.ExitCode, "Should build with the allowed module: %s", res.Compile.Output)
+		assert.Equal(t, "Hello from a module\n", string(res.Stdout))
+	}
+}
+
+func TestAddRequires(t *testing.T) {
+	root := t.TempDir()
+	goMod := "module gorunner\n\ngo 1.23\n\nrequire example.com/own v1.2.3"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte(goMod), 0666))
+
+	err := addRequires(root, []Module{{Path: "example.com/own", Version: "v1.0.0"}, {Path: "example.com/greet", Version: "v1.0.0"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	content, _ := os.ReadFile(filepath.Join(root, "go.mod"))
+	assert.Equal(t, goMod+"\n\nrequire example.com/greet v1.0.0\n", string(content), "Requires of the submission should be kept")
+}
+
+// Create a module cache with a single module, downloaded from a local proxy
+func populateModuleCache(t *testing.T, ctx context.Context, mod Module, files map[string]string) string {
+	t.Helper()
+
+	proxy := filepath.Join(t.TempDir(), filepath.FromSlash(mod.Path), "@v")
+	if err := os.MkdirAll(proxy, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range files {
+		w, err := zw.Create(mod.String() + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	proxyFiles := map[string][]byte{
+		"list":                []byte(mod.Version + "\n"),
+		mod.Version + ".info": []byte(`{"Version":"` + mod.Version + `"}`),
+		mod.Version + ".mod":  []byte(files["go.mod"]),
+		mod.Version + ".zip":  archive.Bytes(),
+	}
+	for name, content := range proxyFiles {
+		if err := os.WriteFile(filepath.Join(proxy, name), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cacheDir := t.TempDir()
+	proxyRoot := strings.TrimSuffix(proxy, filepath.FromSlash("/"+mod.Path+"/@v"))
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", mod.String())
+	cmd.Dir = cacheDir
+	cmd.Env = append(os.Environ(),
+		"GOPROXY=file://"+proxyRoot, "GOSUMDB=off", "GOMODCACHE="+cacheDir, "GOFLAGS=-modcacherw", "GOTOOLCHAIN=local")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("downloading %s: %v: %s", mod, err, out)
+	}
+
+	return cacheDir
+}
+
+func TestNamespaceEnv(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Creating namespaces requires root")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip is not installed")
+	}
+
+	// A service of the host, that runs should not reach
+	host, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer host.Close()
+
+	code := `package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+func main() {
+	_, err := net.Dial("tcp", "` + host.Addr().String() + `")
+	fmt.Println("host reachable:", err == nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go l.Accept()
+	_, err = net.Dial("tcp", l.Addr().String())
+	fmt.Println("loopback reachable:", err == nil)
+
+	entries, _ := os.ReadDir("/proc")
+	processes := 0
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err == nil {
+			processes++
+		}
+	}
+	fmt.Println("pid:", os.Getpid(), "processes:", processes)
+}`
+
+	var (
+		env = NewNamespaceEnv(userenv.SameUserEnv{})
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	if !assert.Equal(t, 0, res.ExitCode, "Stderr: %s, compile: %v", res.Stderr, res.Compile) {
+		return
+	}
+
+	assert.Equal(t, "host reachable: false\nloopback reachable: true\npid: 1 processes: 1\n", string(res.Stdout),
+		"Only loopback of the run and its own processes should be visible")
+}
+
+func TestSeccomp(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func main() {
+	fmt.Println("before")
+	syscall.PtraceAttach(1)
+	fmt.Println("after")
+}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	helper := filepath.Join(t.TempDir(), "seccomp-exec")
+	build := exec.CommandContext(ctx, "go", "build", "-o", helper, "github.com/Marattttt/personal-page/gorunner/cmd/seccomp-exec")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building seccomp-exec: %v: %s", err, out)
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithSeccomp(helper, seccomp.ProfileDeny)
+	)
+
+	res, err := r.Run(ctx, Files{"main.go": code})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.Compile.Success, "The compiler should not be filtered")
+		assert.True(t, res.SyscallBlocked, "Should report the blocked syscall")
+		assert.Equal(t, "before\n", string(res.Stdout), "Should be killed at the syscall")
+	}
+
+	const namespaces = `package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+func main() {
+	fmt.Println(exec.Command("true").Run() == nil)
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	cmd.Run()
+	fmt.Println("after")
+}`
+
+	res, err = r.Run(ctx, Files{"main.go": namespaces})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.SyscallBlocked, "Should block clone with namespace flags")
+		assert.Equal(t, "true\n", string(res.Stdout), "Plain clone should still be allowed")
+	}
+
+	// io_uring_setup has the same number on amd64 and arm64
+	const uring = "package main\n\nimport (\n\t\"fmt\"\n\t\"syscall\"\n)\n\nfunc main() {\n\tfmt.Println(\"before\")\n\tsyscall.Syscall(425, 1, 0, 0)\n\tfmt.Println(\"after\")\n}\n"
+
+	res, err = r.Run(ctx, Files{"main.go": uring})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.SyscallBlocked, "Should block io_uring")
+		assert.Equal(t, "before\n", string(res.Stdout))
+	}
+
+	strict := r.WithSeccomp(helper, seccomp.ProfileStrict)
+
+	res, err = strict.Run(ctx, Files{"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"allowed\")\n}\n"})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.SyscallBlocked, "Stderr: %s", res.Stderr)
+		assert.Equal(t, "allowed\n", string(res.Stdout), "Plain programs should work with the strict profile")
+	}
+
+	res, err = r.Test(ctx, Files{
+		"main.go":      "package main\n\nfunc main() {}\n",
+		"main_test.go": "package main\n\nimport (\n\t\"syscall\"\n\t\"testing\"\n)\n\nfunc TestPtrace(t *testing.T) {\n\tsyscall.PtraceAttach(1)\n}\n",
+	})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.SyscallBlocked, "Should report the blocked syscall of a test binary")
+		assert.Equal(t, 0, res.Tests.Passed)
+	}
+
+	res, err = r.Test(ctx, Files{
+		"main.go":      "package main\n\nfunc main() {}\n",
+		"main_test.go": "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestSpoof(t *testing.T) {\n\tfmt.Println(\"signal: bad system call\")\n\tos.Exit(2)\n}\n",
+	})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.SyscallBlocked, "Printing the message of go test should not be reported as a blocked syscall")
+	}
+}
+
+func TestBuildWasm(t *testing.T) {
+	// Only builds for js/wasm
+	const code = `package main
+
+import "syscall/js"
+
+func main() {
+	js.Global().Get("console").Call("log", "Hello from the browser")
+}`
+
+	cache, err := NewBuildCache(t.TempDir(), 1<<30)
+	if !assert.NoError(t, err, "Should create cache") {
+		return
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithCache(cache)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.BuildWasm(ctx, Files{"main.go": code})
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	if !assert.True(t, res.Compile.Success, "Should compile for wasm: %s", res.Compile.Output) || !assert.NotNil(t, res.Wasm) {
+		return
+	}
+	assert.Equal(t, []byte("\x00asm"), res.Wasm.Binary[:4], "Should return a WebAssembly module")
+	assert.Contains(t, string(res.Wasm.WasmExec), "class", "Should return wasm_exec.js of the toolchain")
+	assert.Zero(t, res.TimeTook, "Should not run anything")
+
+	again, err := r.BuildWasm(ctx, Files{"main.go": code})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, again.CacheHit, "Identical submission should use the cache")
+	}
+
+	native, err := r.Run(ctx, Files{"main.go": code})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, native.CacheHit, "A native build should not use the wasm binary")
+		assert.False(t, native.Compile.Success, "syscall/js should only build for wasm")
+	}
+
+	_, err = r.WithWasmLimit(1<<10).BuildWasm(ctx, Files{"main.go": code})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Should reject a binary over the limit")
+}
+
+func TestBuildArtifact(t *testing.T) {
+	const code = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello from another machine")
+}`
+
+	store, err := NewArtifactStore(t.TempDir(), ArtifactLimits{TTL: time.Minute})
+	if !assert.NoError(t, err, "Should create artifact store") {
+		return
+	}
+
+	windows := Platform{GOOS: "windows", GOARCH: "amd64"}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
 
-		assert.Equal(t, errMsg, "expected 'package', found invalid\n", "Error message from compiler")
+		r = NewRuntime(lck, dir, env).WithArtifacts(store, []Platform{windows})
+	)
+
+	// The standard library is compiled for another platform on the first build
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	res, err := r.BuildArtifact(ctx, Files{"main.go": code}, windows)
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	if !assert.True(t, res.Compile.Success, "Should cross-compile: %s", res.Compile.Output) || !assert.NotNil(t, res.Artifact) {
+		return
+	}
+	assert.Equal(t, "main-windows-amd64.exe", res.Artifact.Name)
+	assert.Empty(t, res.Stdout, "Should not run anything")
+
+	artifact, binary, err := store.Get(res.Artifact.Token)
+	if assert.NoError(t, err, "Should find the stored binary") {
+		assert.Equal(t, "MZ", string(binary[:2]), "Should be a windows executable")
+		assert.Equal(t, res.Artifact.Size, artifact.Size)
+	}
+
+	_, err = r.BuildArtifact(ctx, Files{"main.go": code}, Platform{GOOS: "linux", GOARCH: "arm64"})
+	assert.ErrorIs(t, err, ErrPlatform, "Should reject a platform, that is not allowed")
+
+	_, err = NewRuntime(lck, dir, env).BuildArtifact(ctx, Files{"main.go": code}, windows)
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Should reject builds without a store")
+}
+
+func TestArtifactStore(t *testing.T) {
+	var (
+		storeDir = t.TempDir()
+		src      = filepath.Join(t.TempDir(), "binary")
+		platform = Platform{GOOS: "linux", GOARCH: "amd64"}
+	)
+
+	if !assert.NoError(t, os.WriteFile(src, make([]byte, 100), 0755)) {
+		return
+	}
+
+	// Room for two binaries
+	store, err := NewArtifactStore(storeDir, ArtifactLimits{Size: 100, Total: 250, TTL: time.Minute})
+	if !assert.NoError(t, err, "Should create artifact store") {
+		return
+	}
+
+	var artifacts []*Artifact
+	for range 3 {
+		artifact, err := store.put(src, platform)
+		if !assert.NoError(t, err, "Should store a binary") {
+			return
+		}
+		artifacts = append(artifacts, artifact)
+
+		// Modification times are used to find the oldest artifacts
+		old := time.Now().Add(-time.Second * time.Duration(10-len(artifacts)))
+		assert.NoError(t, os.Chtimes(filepath.Join(storeDir, artifact.Token), old, old))
+	}
+
+	_, _, err = store.Get(artifacts[0].Token)
+	assert.ErrorIs(t, err, ErrUnknownArtifact, "The oldest binary should be evicted")
+	_, _, err = store.Get(artifacts[2].Token)
+	assert.NoError(t, err, "The newest binary should be kept")
+
+	expired := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(storeDir, artifacts[2].Token), expired, expired))
+	_, _, err = store.Get(artifacts[2].Token)
+	assert.ErrorIs(t, err, ErrUnknownArtifact, "An expired binary should not be downloaded")
+
+	_, _, err = store.Get("../" + artifacts[1].Token)
+	assert.ErrorIs(t, err, ErrUnknownArtifact, "Should reject malformed tokens")
+
+	if assert.NoError(t, os.WriteFile(src, make([]byte, 101), 0755)) {
+		_, err = store.put(src, platform)
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "Should reject a binary over the size limit")
+	}
+}
+
+func TestCover(t *testing.T) {
+	const (
+		abs = `package abs
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}`
+
+		tests = `package abs
+
+import "testing"
+
+func TestAbs(t *testing.T) {
+	if Abs(1) != 1 {
+		t.Fatal("wrong abs")
+	}
+}`
+	)
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := r.Cover(ctx, Files{"abs.go": abs, "abs_test.go": tests})
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotNil(t, res.Coverage, "Should report coverage") {
+		return
+	}
+
+	assert.Equal(t, 0, res.ExitCode, "Tests should pass")
+	assert.InDelta(t, 200.0/3, res.Coverage.Percent, 0.01, "Two of three statements should run")
+	assert.Equal(t, []FileCoverage{{
+		File:      "abs.go",
+		Covered:   []LineRange{{Start: 4, End: 4}, {Start: 7, End: 7}},
+		Uncovered: []LineRange{{Start: 5, End: 5}},
+	}}, res.Coverage.Files)
+
+	// go test keeps writing to the profile it opened, so the path can be replaced while tests run
+	for _, replace := range []string{"os.Mkdir(%q, 0777)", "os.Symlink(\"abs.go\", %q)"} {
+		swap := fmt.Sprintf("package abs\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestSwap(t *testing.T) {\n\tos.Remove(%q)\n\t"+replace+"\n}\n", coverName, coverName)
+
+		res, err = r.Cover(ctx, Files{"abs.go": abs, "abs_test.go": swap})
+		if assert.NoError(t, err, "Replacing the profile should not fail the runtime") {
+			assert.Nil(t, res.Coverage, "Should only read a regular profile")
+		}
+	}
+
+	res, err = r.Cover(ctx, Files{"abs.go": abs, "abs_test.go": tests})
+	if assert.NoError(t, err, "A directory left by a previous run should be removed") {
+		assert.NotNil(t, res.Coverage, "Should report coverage")
+	}
+
+	_, err = r.WithCoverLimit(16).Cover(ctx, Files{"abs.go": abs, "abs_test.go": tests})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Profiles over the limit should be rejected")
+
+	res, err = r.Cover(ctx, Files{"abs.go": abs, "abs_test.go": "package abs\nfunc TestX(t *testing.T) {}"})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Nil(t, res.Coverage, "Should not report coverage of tests, that did not build")
+	}
+}
+
+func TestParseCoverProfile(t *testing.T) {
+	const profile = `mode: set
+example.com/m/main.go:3.13,5.2 1 1
+example.com/m/util/main.go:3.13,4.10 1 0
+example.com/m/util/main.go:3.13,4.10 1 1
+example.com/m/util/main.go:6.2,8.1 1 0
+example.com/other/lib.go:1.1,2.2 1 1
+malformed line
+`
+
+	report := parseCoverProfile([]byte(profile), Files{"main.go": "", "util/main.go": "", "go.mod": ""})
+
+	assert.InDelta(t, 200.0/3, report.Percent, 0.01, "Blocks reported twice should be counted once")
+	assert.Equal(t, []FileCoverage{
+		{File: "main.go", Covered: []LineRange{{Start: 3, End: 5}}},
+		{File: "util/main.go", Covered: []LineRange{{Start: 3, End: 4}}, Uncovered: []LineRange{{Start: 6, End: 7}}},
+	}, report.Files)
+}
+
+func TestProfile(t *testing.T) {
+	const code = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var sink [][]byte
+
+func work() int {
+	sum := 0
+	for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+		for i := 0; i < 100000; i++ {
+			sum += i % 7
+		}
+		sink = append(sink, make([]byte, 1024))
+	}
+	return sum
+}
+
+func main() {
+	fmt.Println(work() > 0)
+}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := r.Profile(ctx, Files{"main.go": code}, Input{})
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotNil(t, res.Profile, "Should report profiles") {
+		return
+	}
+
+	assert.Equal(t, "true\n", string(res.Stdout), "The submitted main should run")
+	for name, profile := range map[string]*Profile{"cpu": res.Profile.CPU, "heap": res.Profile.Heap} {
+		if !assert.NotNil(t, profile, "Should write the %s profile", name) {
+			continue
+		}
+		assert.NotEmpty(t, profile.Raw, "Should return the raw %s profile", name)
+		assert.True(t, slices.ContainsFunc(profile.Top, func(e ProfileEntry) bool {
+			return e.Function == "main.work"
+		}), "The %s profile should include the submitted function, got %+v", name, profile.Top)
+	}
+
+	res, err = r.Profile(ctx, Files{"main.go": "package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(3)\n}"}, Input{})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, 3, res.ExitCode, "Exit code should be kept")
+		assert.Nil(t, res.Profile, "Programs, that exit early, should not report profiles of a previous run")
+	}
+
+	// The profiler keeps writing to the file it opened, so the paths can be replaced while the program runs
+	for _, replace := range []string{"os.WriteFile(%q, []byte(\"garbage\"), 0666)", "os.Symlink(\"main.go\", %q)"} {
+		swap := fmt.Sprintf("package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Remove(%q)\n\t"+replace+"\n\tos.Mkdir(%q, 0777)\n}\n",
+			cpuProfileName, cpuProfileName, heapProfileName)
+
+		res, err = r.Profile(ctx, Files{"main.go": swap}, Input{})
+		if assert.NoError(t, err, "Replacing profiles should not fail the runtime") {
+			assert.Nil(t, res.Profile, "Should only report regular profiles, that go tool pprof can read")
+		}
 	}
+
+	res, err = r.Profile(ctx, Files{"main.go": code}, Input{})
+	if assert.NoError(t, err, "A directory left by a previous run should be removed") {
+		assert.NotNil(t, res.Profile, "Should report profiles")
+	}
+
+	_, err = r.WithProfileLimit(16).Profile(ctx, Files{"main.go": code}, Input{})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Profiles over the limit should be rejected")
+
+	_, err = r.Profile(ctx, Files{"main.go": code, cpuProfileName: ""}, Input{})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Profile names should be reserved")
+}
+
+func TestProfileBench(t *testing.T) {
+	const (
+		code = `package sum
+
+func Sum(n int) []int {
+	out := make([]int, 0)
+	for i := range n {
+		out = append(out, i)
+	}
+	return out
+}`
+
+		bench = `package sum
+
+import "testing"
+
+func BenchmarkSum(b *testing.B) {
+	for range b.N {
+		Sum(1000)
+	}
+}`
+	)
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/gorunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := r.ProfileBench(ctx, Files{"sum.go": code, "sum_test.go": bench}, "100ms")
+	if !assert.NoError(t, err, "A system error happened") || !assert.NotNil(t, res.Profile, "Should report profiles") {
+		return
+	}
+
+	assert.Len(t, res.Benchmarks, 1, "Benchmarks should still be reported")
+	if assert.NotNil(t, res.Profile.Heap, "Should write the heap profile") {
+		assert.True(t, slices.ContainsFunc(res.Profile.Heap.Top, func(e ProfileEntry) bool {
+			return strings.HasSuffix(e.Function, ".Sum")
+		}), "The benchmarked function should allocate, got %+v", res.Profile.Heap.Top)
+	}
+	assert.NotNil(t, res.Profile.CPU, "Should write the cpu profile")
+}
+
+func TestParsePprofTop(t *testing.T) {
+	const output = `File: main
+Type: cpu
+Duration: 710.05ms, Total samples = 690ms (97.18%)
+Showing nodes accounting for 690ms, 100% of 690ms total
+      flat  flat%   sum%        cum   cum%
+     680ms 98.55% 98.55%      690ms   100%  main.work (inline)
+ 3127.86kB 61.03% 61.03%  3127.86kB 61.03%  compress/flate.(*fastGen).addBlock
+         0     0%   100%      690ms   100%  main.main
+`
+
+	assert.Equal(t, []ProfileEntry{
+		{Function: "main.work", Flat: "680ms", FlatPercent: 98.55, Cum: "690ms", CumPercent: 100},
+		{Function: "compress/flate.(*fastGen).addBlock", Flat: "3127.86kB", FlatPercent: 61.03, Cum: "3127.86kB", CumPercent: 61.03},
+		{Function: "main.main", Flat: "0", FlatPercent: 0, Cum: "690ms", CumPercent: 100},
+	}, parsePprofTop([]byte(output)))
 }
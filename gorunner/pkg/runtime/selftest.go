@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+)
+
+// Program of the self test, it prints its only argument
+const selfTestCode = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println(os.Args[1])
+}
+`
+
+const selfTestOutput = "gorunner self test"
+
+// Build and run a smoke program the way submissions are run, checking that the environment can execute anything at all
+//
+// Meant to be called once at startup, so that a broken user, directory or limit is noticed before the first submission.
+// The build cache is skipped, so that every slot compiles the program as its own user
+func (r Runtime) SelfTest(ctx context.Context) error {
+	r.cache = nil
+	r.onOutput = nil
+
+	res, err := r.RunWithInput(ctx, Files{"main.go": selfTestCode}, Input{Args: []string{selfTestOutput}})
+	if err != nil {
+		return fmt.Errorf("running smoke program: %w", err)
+	}
+
+	if res.Compile != nil && !res.Compile.Success {
+		return fmt.Errorf("smoke program did not compile: %s", res.Compile.Output)
+	}
+	if res.ExitCode != 0 || string(res.Stdout) != selfTestOutput+"\n" {
+		return fmt.Errorf("smoke program exited with %d, stdout: %q, stderr: %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Named pipe, from which the program of a session reads its stdin, relative to the module root
+const sessionStdinName = ".gorunner-session"
+
+// Limits of interactive sessions
+//
+// Zero values mean no limit
+type SessionLimits struct {
+	// How long a session may go without input or output, before it is stopped
+	Idle time.Duration
+	// Wall-clock limit of a whole session, used in place of the runtime's timeout
+	Total time.Duration
+}
+
+// Apply limits to every session started with RunSession
+func (r Runtime) WithSessionLimits(limits SessionLimits) Runtime {
+	r.sessionLimits = limits
+	return r
+}
+
+// Run the main package of a submission interactively, writing everything received from stdin to the program while it runs
+//
+// input.Stdin is written first, and stdin of the program is closed once stdin is closed. Output is only passed on
+// through the output handler, so a session without one is only useful for its result
+func (r Runtime) RunSession(ctx context.Context, files Files, input Input, stdin <-chan []byte) (*RunResult, error) {
+	if r.sessionLimits.Total > 0 {
+		r.timeout = r.sessionLimits.Total
+	}
+
+	return r.run(ctx, files, input, &session{stdin: stdin, idleTimeout: r.sessionLimits.Idle})
+}
+
+// Input of a running session
+type session struct {
+	stdin       <-chan []byte
+	idleTimeout time.Duration
+
+	pipe *os.File
+	idle *idleTimer
+	// Closed once the program exits
+	done chan struct{}
+}
+
+// Create the named pipe for stdin of the program in root and start writing input to it
+func (s *session) start(root string, initial []byte) error {
+	path := filepath.Join(root, sessionStdinName)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing stdin of a previous session: %w", err)
+	}
+
+	// Readable by everyone, since the program may run as another user
+	if err := syscall.Mkfifo(path, 0644); err != nil {
+		return fmt.Errorf("creating stdin pipe: %w", err)
+	}
+
+	// Opened for reading as well, so that opening does not wait for the program,
+	// which only reads an EOF, once the pipe is closed
+	pipe, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening stdin pipe: %w", err)
+	}
+
+	s.pipe = pipe
+	s.idle = newIdleTimer(s.idleTimeout)
+	s.done = make(chan struct{})
+
+	go s.feed(initial)
+
+	return nil
+}
+
+// Write input to the program until stdin is closed or the program exits
+func (s *session) feed(initial []byte) {
+	if len(initial) > 0 {
+		if _, err := s.pipe.Write(initial); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-s.stdin:
+			if !ok {
+				s.pipe.Close()
+				return
+			}
+
+			s.idle.touch()
+			// Blocks while the program does not read, until the pipe is closed after it exits
+			if _, err := s.pipe.Write(data); err != nil {
+				slog.Debug("Stopped writing input of a session", slog.String("err", err.Error()))
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Wrap an output handler, so that output also counts as activity of the session
+func (s *session) onOutput(handler func(OutputChunk)) func(OutputChunk) {
+	return func(chunk OutputChunk) {
+		s.idle.touch()
+		if handler != nil {
+			handler(chunk)
+		}
+	}
+}
+
+// Stop writing input, once the program exited
+func (s *session) stop() {
+	close(s.done)
+	s.pipe.Close()
+	s.idle.stop()
+}
+
+// Expires, once it was not touched for a while, a nil timer never expires
+type idleTimer struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newIdleTimer(timeout time.Duration) *idleTimer {
+	if timeout <= 0 {
+		return nil
+	}
+	return &idleTimer{timeout: timeout, timer: time.NewTimer(timeout)}
+}
+
+// Start counting the timeout from now
+func (t *idleTimer) touch() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timer.Reset(t.timeout)
+}
+
+func (t *idleTimer) expired() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *idleTimer) stop() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timer.Stop()
+}
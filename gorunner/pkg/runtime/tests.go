@@ -0,0 +1,346 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Statuses of tests and packages, as reported by go test
+const (
+	TestPass = "pass"
+	TestFail = "fail"
+	TestSkip = "skip"
+)
+
+// Results of go test for every package of a submission
+type TestReport struct {
+	Packages []TestPackage `json:"packages"`
+
+	// Counts of tests, including subtests, by status
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Results of a single package
+type TestPackage struct {
+	// Import path, e.g. gorunner/util
+	Package string `json:"package"`
+	// One of the test statuses, empty if go test did not report one, e.g. after a timeout
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Output, that does not belong to any test, e.g. the final ok or FAIL line
+	Output string `json:"output,omitempty"`
+	// Whether the package failed, because it or its tests could not be built
+	BuildFailed bool `json:"buildFailed,omitempty"`
+
+	Tests []TestCase `json:"tests,omitempty"`
+}
+
+// Result of a single test or subtest
+type TestCase struct {
+	// Name as passed to -run, e.g. TestSum/negative
+	Name    string        `json:"name"`
+	Status  string        `json:"status"`
+	Elapsed time.Duration `json:"elapsed"`
+	Output  string        `json:"output,omitempty"`
+}
+
+// Run tests of every package of a submission with go test
+//
+// Tests are user code, so limits of the runtime apply to the whole go test invocation.
+// Packages, that could not be built, are also reported as diagnostics in RunResult.Compile
+func (r Runtime) Test(ctx context.Context, files Files) (*RunResult, error) {
+	res, err := r.goTest(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Tests != nil {
+		slog.Info("Finished testing user code",
+			slog.Int("passed", res.Tests.Passed),
+			slog.Int("failed", res.Tests.Failed),
+			slog.Int("skipped", res.Tests.Skipped),
+			slog.Duration("timeTook", res.TimeTook))
+	}
+
+	return res, nil
+}
+
+// Run go test -json with extra flags, reporting results of every package
+func (r Runtime) goTest(ctx context.Context, files Files, flags ...string) (*RunResult, error) {
+	if err := files.ValidateTests(); err != nil {
+		return nil, err
+	}
+	if rejected := rejectImports(files, r.modules); rejected != nil {
+		return &RunResult{Compile: rejected, ExitCode: rejected.ExitCode}, nil
+	}
+	env, err := r.environment.merge(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.initEnvironment(ctx, toolchain, files); err != nil {
+		return nil, fmt.Errorf("creating environment: %w", err)
+	}
+	if err := r.own(); err != nil {
+		return nil, err
+	}
+
+	command := "cd " + shellQuote(r.root) + " && "
+	var marker string
+	if r.seccomp != nil {
+		if marker, err = newSIGSYSMarker(); err != nil {
+			return nil, err
+		}
+		// The shell reads commands from stdin, so the marker is not in any command line, and env -i hides it from test binaries
+		command += sigsysMarkerVar + "=" + marker + " "
+	}
+	command += r.goCommand(toolchain) + " test -json"
+	if r.cover {
+		// A profile of a previous run would be reported for tests, that do not build, user code could also leave a directory
+		if err := os.RemoveAll(filepath.Join(r.root, coverName)); err != nil {
+			return nil, fmt.Errorf("removing previous coverage profile: %w", err)
+		}
+		flags = append(flags, "-covermode=set", "-coverprofile="+coverName)
+	}
+	// go test profiles only a single package
+	packages := "./..."
+	if r.profile {
+		if err := r.removeProfiles(); err != nil {
+			return nil, err
+		}
+		flags = append(flags, profileFlags()...)
+		packages = "."
+	}
+	for _, flag := range append(r.buildOptions.flags(), flags...) {
+		command += " " + shellQuote(flag)
+	}
+	// Only test binaries are isolated, not the toolchain, that builds them
+	program := isolate(env, r.confine()...)
+	if marker != "" {
+		program = reportSIGSYS(program)
+	}
+	execArgs, err := joinExecArgs(program)
+	if err != nil {
+		return nil, fmt.Errorf("passing environment to go test: %w", err)
+	}
+	command += " -exec " + shellQuote(execArgs)
+	command += " " + packages + " < /dev/null"
+
+	ex, err := r.execute(ctx, command, execOptions{limitResources: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report, buildOutput := parseTestEvents(ex.stdout)
+	// Older toolchains write build errors to stderr even with -json
+	buildOutput = append(buildOutput, ex.stderr...)
+
+	res := &RunResult{
+		Stdout:   ex.stdout,
+		Stderr:   ex.stderr,
+		ExitCode: ex.exitCode,
+
+		StdoutTruncated: ex.stdoutTruncated,
+		StderrTruncated: ex.stderrTruncated,
+
+		TimeTook: ex.timeTook,
+
+		TimedOut:     ex.timedOut,
+		LimitHit:     ex.limitHit,
+		CPUThrottled: ex.cpuThrottled,
+		// Printed by the -exec wrapper, test binaries can not know the marker to spoof it
+		SyscallBlocked: marker != "" && bytes.Contains(ex.stdout, []byte(marker)),
+
+		GoVersion: toolchain.Version,
+		Tests:     report,
+	}
+
+	if report.buildFailed() {
+		res.Compile = &CompileResult{
+			Diagnostics: parseDiagnostics(buildOutput, r.root),
+			Output:      buildOutput,
+			ExitCode:    ex.exitCode,
+		}
+	}
+
+	if r.cover {
+		if res.Coverage, err = r.readCoverage(files); err != nil {
+			return nil, err
+		}
+	}
+	if r.profile {
+		if res.Profile, err = r.readProfiles(ctx, toolchain); err != nil {
+			return nil, err
+		}
+	}
+
+	// Races are reported in the output of the test, during which they were found
+	if r.buildOptions.Race {
+		for _, pkg := range report.Packages {
+			for _, test := range pkg.Tests {
+				res.Races = append(res.Races, parseRaces([]byte(test.Output), r.root)...)
+			}
+			res.Races = append(res.Races, parseRaces([]byte(pkg.Output), r.root)...)
+		}
+	}
+
+	return res, nil
+}
+
+// Variable, through which the -exec wrapper of go test gets the marker of a blocked syscall
+const sigsysMarkerVar = "GORUNNER_SIGSYS_MARKER"
+
+// Exit status of a shell command, that was killed with SIGSYS
+const sigsysStatus = 128 + int(syscall.SIGSYS)
+
+// A random line, printed by the -exec wrapper of go test, when a test binary is killed with SIGSYS
+//
+// go test only reports the signal in the output, which a test can print as well
+func newSIGSYSMarker() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("generating syscall marker: %w", err)
+	}
+	return "gorunner-sigsys-" + hex.EncodeToString(random), nil
+}
+
+// Arguments, that run a program and print the marker from sigsysMarkerVar, if it is killed with SIGSYS
+func reportSIGSYS(program []string) []string {
+	script := fmt.Sprintf(`"$@"; status=$?; if [ $status -eq %d ]; then echo "$%s"; fi; exit $status`, sigsysStatus, sigsysMarkerVar)
+	return append([]string{"sh", "-c", script, "sh"}, program...)
+}
+
+func (t *TestReport) buildFailed() bool {
+	for _, pkg := range t.Packages {
+		if pkg.BuildFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// A single line of go test -json, see go doc test2json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	// Seconds
+	Elapsed float64
+	Output  string
+	// Set on a package fail event, if the package could not be built
+	FailedBuild string
+}
+
+// Build a report from a go test -json stream, returning it along with the output of failed builds
+//
+// Lines, that are not events, are skipped, so that a stream cut short by output limits is still reported
+func parseTestEvents(stream []byte) (*TestReport, []byte) {
+	var (
+		report      TestReport
+		buildOutput bytes.Buffer
+
+		packages = make(map[string]int)
+		tests    = make(map[[2]string]int)
+	)
+
+	for _, line := range bytes.Split(stream, []byte("\n")) {
+		var ev testEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+
+		switch ev.Action {
+		case "build-output":
+			buildOutput.WriteString(ev.Output)
+			continue
+		case "build-fail":
+			continue
+		}
+
+		if ev.Package == "" {
+			continue
+		}
+
+		i, ok := packages[ev.Package]
+		if !ok {
+			i = len(report.Packages)
+			packages[ev.Package] = i
+			report.Packages = append(report.Packages, TestPackage{Package: ev.Package})
+		}
+		pkg := &report.Packages[i]
+
+		if ev.Test == "" {
+			switch ev.Action {
+			case "output":
+				pkg.Output += ev.Output
+				// Older toolchains only report failed builds in the output
+				if strings.Contains(ev.Output, "[build failed]") || strings.Contains(ev.Output, "[setup failed]") {
+					pkg.BuildFailed = true
+				}
+			case TestPass, TestFail, TestSkip:
+				pkg.Status = ev.Action
+				pkg.Elapsed = seconds(ev.Elapsed)
+				if ev.FailedBuild != "" {
+					pkg.BuildFailed = true
+				}
+			}
+			continue
+		}
+
+		key := [2]string{ev.Package, ev.Test}
+		j, ok := tests[key]
+		if !ok {
+			j = len(pkg.Tests)
+			tests[key] = j
+			pkg.Tests = append(pkg.Tests, TestCase{Name: ev.Test})
+		}
+		test := &pkg.Tests[j]
+
+		switch ev.Action {
+		case "output":
+			test.Output += ev.Output
+		case TestPass, TestFail, TestSkip:
+			test.Status = ev.Action
+			test.Elapsed = seconds(ev.Elapsed)
+		}
+	}
+
+	for _, pkg := range report.Packages {
+		for _, test := range pkg.Tests {
+			switch test.Status {
+			case TestPass:
+				report.Passed++
+			case TestFail:
+				report.Failed++
+			case TestSkip:
+				report.Skipped++
+			}
+		}
+	}
+
+	return &report, buildOutput.Bytes()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/version"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Returned (wrapped) when a submission asks for a go version, that is not installed
+var ErrUnknownToolchain = fmt.Errorf("%w: unknown go version", ErrInvalidSubmission)
+
+// A single go installation
+type Toolchain struct {
+	// As reported by go env GOVERSION, e.g. go1.23.1
+	Version string `json:"version"`
+	GOROOT  string `json:"goroot"`
+}
+
+// Path of the go executable of the toolchain
+func (t Toolchain) GoPath() string {
+	return filepath.Join(t.GOROOT, "bin", "go")
+}
+
+// Start of a shell command line, that runs the go executable of the toolchain
+//
+// Toolchain switching is disabled, so a go.mod can not make it download and run another version
+func (t Toolchain) command() string {
+	return "GOTOOLCHAIN=local " + shellQuote(t.GoPath())
+}
+
+// Installed toolchains, that submissions can choose from
+type Toolchains struct {
+	byVersion map[string]Toolchain
+	// Used when a submission does not ask for a version
+	def Toolchain
+}
+
+// Register a toolchain for every GOROOT, the first one is the default
+//
+// Versions are read from the toolchains themselves, so they are always accurate
+func NewToolchains(ctx context.Context, goroots []string) (*Toolchains, error) {
+	if len(goroots) == 0 {
+		return nil, errors.New("no toolchains provided")
+	}
+
+	t := &Toolchains{byVersion: make(map[string]Toolchain, len(goroots))}
+
+	for i, goroot := range goroots {
+		abs, err := filepath.Abs(goroot)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", goroot, err)
+		}
+
+		toolchain := Toolchain{GOROOT: abs}
+		toolchain.Version, err = goVersion(ctx, toolchain.GoPath())
+		if err != nil {
+			return nil, fmt.Errorf("getting version of %s: %w", goroot, err)
+		}
+
+		if other, ok := t.byVersion[toolchain.Version]; ok {
+			return nil, fmt.Errorf("%s and %s are both %s", other.GOROOT, abs, toolchain.Version)
+		}
+		t.byVersion[toolchain.Version] = toolchain
+
+		if i == 0 {
+			t.def = toolchain
+		}
+
+		slog.Info("Registered go toolchain", slog.String("version", toolchain.Version), slog.String("goroot", abs))
+	}
+
+	return t, nil
+}
+
+// Register the toolchain found in PATH as the only one
+func DetectToolchains(ctx context.Context) (*Toolchains, error) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		return nil, fmt.Errorf("looking up go: %w", err)
+	}
+
+	out, err := exec.CommandContext(ctx, goPath, "env", "GOROOT").Output()
+	if err != nil {
+		return nil, fmt.Errorf("running go env: %w", err)
+	}
+
+	return NewToolchains(ctx, []string{strings.TrimSpace(string(out))})
+}
+
+// Find a toolchain by version, e.g. go1.23.1 or 1.23.1, an empty version means the default one
+func (t *Toolchains) Get(v string) (Toolchain, error) {
+	if v == "" {
+		return t.def, nil
+	}
+
+	if !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+
+	toolchain, ok := t.byVersion[v]
+	if !ok {
+		return Toolchain{}, fmt.Errorf("%w: %s is not installed, available versions are %s",
+			ErrUnknownToolchain, v, strings.Join(t.Versions(), ", "))
+	}
+
+	return toolchain, nil
+}
+
+// Default toolchain, used when a submission does not ask for a version
+func (t *Toolchains) Default() Toolchain {
+	return t.def
+}
+
+// Sorted versions of all installed toolchains
+func (t *Toolchains) Versions() []string {
+	versions := make([]string, 0, len(t.byVersion))
+	for v := range t.byVersion {
+		versions = append(versions, v)
+	}
+	slices.SortFunc(versions, version.Compare)
+
+	return versions
+}
+
+// Toolchains found in PATH, used by runtimes without a registry
+//
+// Detected once, so that runs do not look for go every time
+var pathToolchains = sync.OnceValues(func() (*Toolchains, error) {
+	return DetectToolchains(context.Background())
+})
+
+// Get version of the toolchain at goPath, e.g. go1.23.1
+func goVersion(ctx context.Context, goPath string) (string, error) {
+	cmd := exec.CommandContext(ctx, goPath, "env", "GOVERSION")
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running go env: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Platform of programs, that run in the browser
+var wasmPlatform = Platform{GOOS: "js", GOARCH: "wasm"}
+
+// A program built for the browser, which is run there instead of on the runner
+type WasmArtifact struct {
+	// The WebAssembly module
+	Binary []byte `json:"binary"`
+	// wasm_exec.js of the toolchain, that built the module, which the page needs to run it
+	WasmExec []byte `json:"wasmExec"`
+}
+
+// Reject WebAssembly binaries larger than max bytes, 0 for no limit
+func (r Runtime) WithWasmLimit(max int64) Runtime {
+	r.wasmLimit = max
+	return r
+}
+
+// Build the main package of a submission with GOOS=js GOARCH=wasm, returning the binary in RunResult.Wasm
+//
+// Nothing is run, so the result only has the build phase, and TimeTook is always zero. A binary larger than
+// the limit of the runtime is an ErrInvalidSubmission
+func (r Runtime) BuildWasm(ctx context.Context, files Files) (*RunResult, error) {
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+	if rejected := rejectImports(files, r.modules); rejected != nil {
+		return &RunResult{Compile: rejected, ExitCode: rejected.ExitCode}, nil
+	}
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	toolchain, err := r.goToolchain()
+	if err != nil {
+		return nil, err
+	}
+
+	r.target = &wasmPlatform
+	compiled, cacheHit, err := r.build(ctx, toolchain, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compiled.Success {
+		slog.Info("Submission did not compile for wasm", slog.Any("diagnostics", compiled.Diagnostics))
+		return &RunResult{Compile: compiled, ExitCode: compiled.ExitCode}, nil
+	}
+
+	binary, err := r.readWasm()
+	if err != nil {
+		return nil, err
+	}
+
+	wasmExec, err := toolchain.WasmExec()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Built user code for wasm", slog.Int("bytes", len(binary)), slog.Bool("cacheHit", cacheHit))
+
+	return &RunResult{
+		Compile:   compiled,
+		CacheHit:  cacheHit,
+		GoVersion: toolchain.Version,
+		Wasm:      &WasmArtifact{Binary: binary, WasmExec: wasmExec},
+	}, nil
+}
+
+// Read the built binary, checking its size first, so that a large one is never loaded
+func (r Runtime) readWasm() ([]byte, error) {
+	path := filepath.Join(r.root, binaryName)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("checking wasm binary: %w", err)
+	}
+	if r.wasmLimit > 0 && info.Size() > r.wasmLimit {
+		return nil, fmt.Errorf("%w: wasm binary is %d bytes, at most %d are allowed", ErrInvalidSubmission, info.Size(), r.wasmLimit)
+	}
+
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading wasm binary: %w", err)
+	}
+
+	return binary, nil
+}
+
+// Contents of wasm_exec.js, which has to come from the same toolchain as the binary, that it runs
+//
+// Located in lib/wasm since go1.24, and in misc/wasm before
+func (t Toolchain) WasmExec() ([]byte, error) {
+	for _, dir := range []string{"lib", "misc"} {
+		content, err := os.ReadFile(filepath.Join(t.GOROOT, dir, "wasm", "wasm_exec.js"))
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading wasm_exec.js of %s: %w", t.Version, err)
+		}
+	}
+
+	return nil, fmt.Errorf("%s has no wasm_exec.js", t.Version)
+}
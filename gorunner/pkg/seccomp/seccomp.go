@@ -0,0 +1,195 @@
+// Package seccomp restricts syscalls, that a process and everything it executes can make
+//
+// A filter is installed right before executing a user program, so that the toolchain,
+// which starts it, is not affected. A process, that makes a forbidden syscall, is killed
+// with SIGSYS
+package seccomp
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Set of syscalls, that a program is allowed to make
+type Profile string
+
+const (
+	// Everything except syscalls, that manipulate the system or other processes, e.g. ptrace, mount or keyctl
+	ProfileDeny Profile = "deny"
+	// Only syscalls, that are needed to compute and work with files, networking is not allowed
+	ProfileStrict Profile = "strict"
+)
+
+// Parse a profile by name, an empty name means ProfileDeny
+func ParseProfile(name string) (Profile, error) {
+	switch Profile(name) {
+	case "", ProfileDeny:
+		return ProfileDeny, nil
+	case ProfileStrict:
+		return ProfileStrict, nil
+	default:
+		return "", fmt.Errorf("unknown seccomp profile %q, expected %s or %s", name, ProfileDeny, ProfileStrict)
+	}
+}
+
+// Syscalls, that ProfileDeny kills a process for
+var denied = []string{
+	"ptrace", "process_vm_readv", "process_vm_writev", "kcmp",
+	"mount", "umount2", "pivot_root", "chroot", "unshare", "setns",
+	"fsopen", "fsconfig", "fsmount", "move_mount", "open_tree", "fspick", "mount_setattr",
+	// Work submitted through io_uring is not filtered by syscalls
+	"io_uring_setup", "io_uring_enter", "io_uring_register",
+	"add_key", "request_key", "keyctl",
+	"init_module", "finit_module", "delete_module", "kexec_load", "kexec_file_load",
+	"bpf", "perf_event_open", "userfaultfd", "lookup_dcookie", "fanotify_init",
+	"open_by_handle_at", "name_to_handle_at",
+	"reboot", "swapon", "swapoff", "acct", "quotactl", "syslog",
+	"sethostname", "setdomainname",
+	"settimeofday", "clock_settime", "clock_adjtime", "adjtimex",
+	"iopl", "ioperm",
+}
+
+// Syscalls, that ProfileStrict allows, covers runtimes of go and node
+var allowed = []string{
+	// Files
+	"read", "write", "readv", "writev", "pread64", "pwrite64", "open", "openat", "close", "close_range",
+	"lseek", "stat", "fstat", "lstat", "newfstatat", "statx", "statfs", "fstatfs",
+	"access", "faccessat", "faccessat2", "readlink", "readlinkat", "getdents64", "getcwd", "chdir", "fchdir",
+	"mkdir", "mkdirat", "rmdir", "unlink", "unlinkat", "rename", "renameat", "renameat2",
+	"chmod", "fchmod", "fchmodat", "ftruncate", "fsync", "fdatasync", "flock", "fadvise64", "copy_file_range",
+	"sendfile", "umask", "utimensat",
+	// Descriptors and polling
+	"dup", "dup2", "dup3", "fcntl", "ioctl", "pipe", "pipe2", "eventfd2",
+	"poll", "ppoll", "select", "pselect6", "epoll_create1", "epoll_ctl", "epoll_wait", "epoll_pwait", "epoll_pwait2",
+	"inotify_init1", "inotify_add_watch", "inotify_rm_watch", "timerfd_create", "timerfd_settime", "timerfd_gettime",
+	"signalfd4",
+	// Memory
+	"mmap", "munmap", "mprotect", "mremap", "madvise", "brk", "mincore", "msync", "mlock", "munlock", "membarrier",
+	"memfd_create", "pkey_alloc", "pkey_free", "pkey_mprotect",
+	// Processes and threads
+	"clone", "execve", "exit", "exit_group", "wait4", "waitid", "set_tid_address", "set_robust_list",
+	"get_robust_list", "rseq", "futex", "sched_yield", "sched_getaffinity", "arch_prctl", "prctl",
+	"getpid", "getppid", "gettid", "getuid", "geteuid", "getgid", "getegid", "getresuid", "getresgid", "getgroups",
+	"getpgid", "getpgrp", "getsid", "setpgid", "getrlimit", "prlimit64", "getrusage", "getpriority", "getcpu",
+	"uname", "sysinfo", "capget",
+	// Signals
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "rt_sigpending", "rt_sigtimedwait", "rt_sigsuspend",
+	"sigaltstack", "kill", "tkill", "tgkill", "restart_syscall",
+	// Time and randomness
+	"nanosleep", "clock_nanosleep", "clock_gettime", "clock_getres", "gettimeofday", "time", "times",
+	"getitimer", "setitimer", "getrandom",
+	// Per-thread timers of the go cpu profiler
+	"timer_create", "timer_settime", "timer_gettime", "timer_getoverrun", "timer_delete",
+}
+
+// Classic BPF instruction, struct sock_filter
+type instruction struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+const (
+	bpfLdWAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJsetK  = 0x45 // BPF_JMP | BPF_JSET | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+	retKillProcess = 0x80000000
+	retAllow       = 0x7fff0000
+	retErrno       = 0x00050000
+	// The same number on every supported architecture
+	errnoENOSYS = 38
+
+	// Offsets in struct seccomp_data
+	offsetNr   = 0
+	offsetArch = 4
+	// Lower half of the first argument on little endian architectures
+	offsetArg0 = 16
+
+	// CLONE_NEWNS, CLONE_NEWCGROUP, CLONE_NEWUTS, CLONE_NEWIPC, CLONE_NEWUSER, CLONE_NEWPID and CLONE_NEWNET,
+	// CLONE_NEWTIME only exists for clone3 and overlaps with the exit signal of clone
+	cloneNewNamespaces = 0x7e020000
+
+	// Set for syscalls of the x32 abi, which would otherwise bypass the numbers of amd64
+	x32SyscallBit = 0x40000000
+)
+
+// Build a filter program for an architecture with its syscall numbers
+//
+// Syscalls, that the architecture does not have, are skipped. Syscalls of other architectures
+// are never allowed, since their numbers mean different things
+func filter(profile Profile, arch uint32, numbers map[string]uint32) ([]instruction, error) {
+	var names []string
+	var match, otherwise uint32
+
+	switch profile {
+	case ProfileDeny:
+		names, match, otherwise = denied, retKillProcess, retAllow
+	case ProfileStrict:
+		names, match, otherwise = allowed, retAllow, retKillProcess
+	default:
+		return nil, fmt.Errorf("unknown seccomp profile %q", profile)
+	}
+
+	var nrs []uint32
+	for _, name := range names {
+		if nr, ok := numbers[name]; ok && !slices.Contains(nrs, nr) {
+			nrs = append(nrs, nr)
+		}
+	}
+	// Jump offsets are 8 bit
+	if len(nrs) > 250 {
+		return nil, fmt.Errorf("too many syscalls in profile %s", profile)
+	}
+
+	prog := []instruction{
+		{code: bpfLdWAbs, k: offsetArch},
+		{code: bpfJeqK, jt: 1, k: arch},
+		{code: bpfRetK, k: retKillProcess},
+		{code: bpfLdWAbs, k: offsetNr},
+		{code: bpfJsetK, jf: 1, k: x32SyscallBit},
+		{code: bpfRetK, k: retKillProcess},
+	}
+	prog = append(prog, namespaceRules(numbers)...)
+
+	// Every match jumps over the rest of the comparisons and the default return
+	for i, nr := range nrs {
+		prog = append(prog, instruction{code: bpfJeqK, jt: uint8(len(nrs) - i), k: nr})
+	}
+	prog = append(prog,
+		instruction{code: bpfRetK, k: otherwise},
+		instruction{code: bpfRetK, k: match},
+	)
+
+	return prog, nil
+}
+
+// Instructions, that keep every profile from creating namespaces, like unshare and setns in ProfileDeny do
+//
+// Flags of clone are checked by its first argument. Flags of clone3 are in memory, which filters can not read,
+// so it fails with ENOSYS, after which the c library and the go runtime fall back to clone. The syscall number
+// is loaded again afterwards
+func namespaceRules(numbers map[string]uint32) []instruction {
+	var prog []instruction
+
+	if nr, ok := numbers["clone3"]; ok {
+		prog = append(prog,
+			instruction{code: bpfJeqK, jf: 1, k: nr},
+			instruction{code: bpfRetK, k: retErrno | errnoENOSYS},
+		)
+	}
+
+	if nr, ok := numbers["clone"]; ok {
+		prog = append(prog,
+			instruction{code: bpfJeqK, jf: 4, k: nr},
+			instruction{code: bpfLdWAbs, k: offsetArg0},
+			instruction{code: bpfJsetK, jf: 1, k: cloneNewNamespaces},
+			instruction{code: bpfRetK, k: retKillProcess},
+			instruction{code: bpfLdWAbs, k: offsetNr},
+		)
+	}
+
+	return prog
+}
@@ -0,0 +1,51 @@
+//go:build linux && (amd64 || arm64)
+
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs = 38
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+)
+
+// struct sock_fprog
+type program struct {
+	len    uint16
+	filter *instruction
+}
+
+// Install a filter for the profile on every thread of the process
+//
+// Privileges can no longer be gained afterwards, e.g. through setuid binaries. The calling
+// goroutine stays locked to its thread, so that a following exec happens on a filtered thread
+func Install(profile Profile) error {
+	prog, err := filter(profile, auditArch, syscallNumbers)
+	if err != nil {
+		return err
+	}
+
+	runtime.LockOSThread()
+
+	// Required for unprivileged processes to install filters
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("setting no_new_privs: %w", errno)
+	}
+
+	fprog := program{len: uint16(len(prog)), filter: &prog[0]}
+
+	_, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&fprog)))
+	runtime.KeepAlive(prog)
+	if errno != 0 {
+		return fmt.Errorf("installing seccomp filter: %w", errno)
+	}
+
+	return nil
+}
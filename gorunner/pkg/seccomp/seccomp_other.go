@@ -0,0 +1,10 @@
+//go:build !linux || !(amd64 || arm64)
+
+package seccomp
+
+import "errors"
+
+// Filters are only built for linux on amd64 and arm64
+func Install(profile Profile) error {
+	return errors.New("seccomp is only supported on linux/amd64 and linux/arm64")
+}
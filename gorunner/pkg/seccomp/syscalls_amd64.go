@@ -0,0 +1,209 @@
+package seccomp
+
+// AUDIT_ARCH_X86_64
+const auditArch = 0xc000003e
+
+const sysSeccomp = 317
+
+// Numbers of syscalls, that profiles mention, see arch/x86/entry/syscalls/syscall_64.tbl in linux
+var syscallNumbers = map[string]uint32{
+	"read":              0,
+	"write":             1,
+	"open":              2,
+	"close":             3,
+	"stat":              4,
+	"fstat":             5,
+	"lstat":             6,
+	"poll":              7,
+	"lseek":             8,
+	"mmap":              9,
+	"mprotect":          10,
+	"munmap":            11,
+	"brk":               12,
+	"rt_sigaction":      13,
+	"rt_sigprocmask":    14,
+	"rt_sigreturn":      15,
+	"ioctl":             16,
+	"pread64":           17,
+	"pwrite64":          18,
+	"readv":             19,
+	"writev":            20,
+	"access":            21,
+	"pipe":              22,
+	"select":            23,
+	"sched_yield":       24,
+	"mremap":            25,
+	"msync":             26,
+	"mincore":           27,
+	"madvise":           28,
+	"dup":               32,
+	"dup2":              33,
+	"nanosleep":         35,
+	"getitimer":         36,
+	"setitimer":         38,
+	"getpid":            39,
+	"sendfile":          40,
+	"clone":             56,
+	"execve":            59,
+	"exit":              60,
+	"wait4":             61,
+	"kill":              62,
+	"uname":             63,
+	"fcntl":             72,
+	"flock":             73,
+	"fsync":             74,
+	"fdatasync":         75,
+	"ftruncate":         77,
+	"getcwd":            79,
+	"chdir":             80,
+	"fchdir":            81,
+	"rename":            82,
+	"mkdir":             83,
+	"rmdir":             84,
+	"unlink":            87,
+	"readlink":          89,
+	"chmod":             90,
+	"fchmod":            91,
+	"umask":             95,
+	"gettimeofday":      96,
+	"getrlimit":         97,
+	"getrusage":         98,
+	"sysinfo":           99,
+	"times":             100,
+	"ptrace":            101,
+	"getuid":            102,
+	"syslog":            103,
+	"getgid":            104,
+	"geteuid":           107,
+	"getegid":           108,
+	"setpgid":           109,
+	"getppid":           110,
+	"getpgrp":           111,
+	"getgroups":         115,
+	"getresuid":         118,
+	"getresgid":         120,
+	"getpgid":           121,
+	"getsid":            124,
+	"capget":            125,
+	"rt_sigpending":     127,
+	"rt_sigtimedwait":   128,
+	"rt_sigsuspend":     130,
+	"sigaltstack":       131,
+	"statfs":            137,
+	"fstatfs":           138,
+	"getpriority":       140,
+	"mlock":             149,
+	"munlock":           150,
+	"pivot_root":        155,
+	"prctl":             157,
+	"arch_prctl":        158,
+	"adjtimex":          159,
+	"chroot":            161,
+	"acct":              163,
+	"settimeofday":      164,
+	"mount":             165,
+	"umount2":           166,
+	"swapon":            167,
+	"swapoff":           168,
+	"reboot":            169,
+	"sethostname":       170,
+	"setdomainname":     171,
+	"iopl":              172,
+	"ioperm":            173,
+	"init_module":       175,
+	"delete_module":     176,
+	"quotactl":          179,
+	"gettid":            186,
+	"tkill":             200,
+	"time":              201,
+	"futex":             202,
+	"sched_getaffinity": 204,
+	"lookup_dcookie":    212,
+	"getdents64":        217,
+	"set_tid_address":   218,
+	"restart_syscall":   219,
+	"fadvise64":         221,
+	"timer_create":      222,
+	"timer_settime":     223,
+	"timer_gettime":     224,
+	"timer_getoverrun":  225,
+	"timer_delete":      226,
+	"clock_settime":     227,
+	"clock_gettime":     228,
+	"clock_getres":      229,
+	"clock_nanosleep":   230,
+	"exit_group":        231,
+	"epoll_wait":        232,
+	"epoll_ctl":         233,
+	"tgkill":            234,
+	"kexec_load":        246,
+	"waitid":            247,
+	"add_key":           248,
+	"request_key":       249,
+	"keyctl":            250,
+	"inotify_add_watch": 254,
+	"inotify_rm_watch":  255,
+	"openat":            257,
+	"mkdirat":           258,
+	"newfstatat":        262,
+	"unlinkat":          263,
+	"renameat":          264,
+	"readlinkat":        267,
+	"fchmodat":          268,
+	"faccessat":         269,
+	"pselect6":          270,
+	"ppoll":             271,
+	"unshare":           272,
+	"set_robust_list":   273,
+	"get_robust_list":   274,
+	"utimensat":         280,
+	"epoll_pwait":       281,
+	"timerfd_create":    283,
+	"timerfd_settime":   286,
+	"timerfd_gettime":   287,
+	"signalfd4":         289,
+	"eventfd2":          290,
+	"epoll_create1":     291,
+	"dup3":              292,
+	"pipe2":             293,
+	"inotify_init1":     294,
+	"perf_event_open":   298,
+	"fanotify_init":     300,
+	"prlimit64":         302,
+	"name_to_handle_at": 303,
+	"open_by_handle_at": 304,
+	"clock_adjtime":     305,
+	"setns":             308,
+	"getcpu":            309,
+	"process_vm_readv":  310,
+	"process_vm_writev": 311,
+	"kcmp":              312,
+	"finit_module":      313,
+	"renameat2":         316,
+	"getrandom":         318,
+	"memfd_create":      319,
+	"kexec_file_load":   320,
+	"bpf":               321,
+	"userfaultfd":       323,
+	"membarrier":        324,
+	"copy_file_range":   326,
+	"pkey_mprotect":     329,
+	"pkey_alloc":        330,
+	"pkey_free":         331,
+	"statx":             332,
+	"rseq":              334,
+	"io_uring_setup":    425,
+	"io_uring_enter":    426,
+	"io_uring_register": 427,
+	"open_tree":         428,
+	"move_mount":        429,
+	"fsopen":            430,
+	"fsconfig":          431,
+	"fsmount":           432,
+	"fspick":            433,
+	"clone3":            435,
+	"close_range":       436,
+	"faccessat2":        439,
+	"epoll_pwait2":      441,
+	"mount_setattr":     442,
+}
@@ -0,0 +1,189 @@
+package seccomp
+
+// AUDIT_ARCH_AARCH64
+const auditArch = 0xc00000b7
+
+const sysSeccomp = 277
+
+// Numbers of syscalls, that profiles mention, see include/uapi/asm-generic/unistd.h in linux
+var syscallNumbers = map[string]uint32{
+	"getcwd":            17,
+	"lookup_dcookie":    18,
+	"eventfd2":          19,
+	"epoll_create1":     20,
+	"epoll_ctl":         21,
+	"epoll_pwait":       22,
+	"dup":               23,
+	"dup3":              24,
+	"fcntl":             25,
+	"inotify_init1":     26,
+	"inotify_add_watch": 27,
+	"inotify_rm_watch":  28,
+	"ioctl":             29,
+	"flock":             32,
+	"mkdirat":           34,
+	"unlinkat":          35,
+	"renameat":          38,
+	"umount2":           39,
+	"mount":             40,
+	"pivot_root":        41,
+	"statfs":            43,
+	"fstatfs":           44,
+	"ftruncate":         46,
+	"faccessat":         48,
+	"chdir":             49,
+	"fchdir":            50,
+	"chroot":            51,
+	"fchmod":            52,
+	"fchmodat":          53,
+	"openat":            56,
+	"close":             57,
+	"pipe2":             59,
+	"quotactl":          60,
+	"getdents64":        61,
+	"lseek":             62,
+	"read":              63,
+	"write":             64,
+	"readv":             65,
+	"writev":            66,
+	"pread64":           67,
+	"pwrite64":          68,
+	"sendfile":          71,
+	"pselect6":          72,
+	"ppoll":             73,
+	"signalfd4":         74,
+	"readlinkat":        78,
+	"newfstatat":        79,
+	"fstat":             80,
+	"fsync":             82,
+	"fdatasync":         83,
+	"timerfd_create":    85,
+	"timerfd_settime":   86,
+	"timerfd_gettime":   87,
+	"utimensat":         88,
+	"acct":              89,
+	"capget":            90,
+	"exit":              93,
+	"exit_group":        94,
+	"waitid":            95,
+	"set_tid_address":   96,
+	"unshare":           97,
+	"futex":             98,
+	"set_robust_list":   99,
+	"get_robust_list":   100,
+	"nanosleep":         101,
+	"getitimer":         102,
+	"setitimer":         103,
+	"kexec_load":        104,
+	"init_module":       105,
+	"delete_module":     106,
+	"timer_create":      107,
+	"timer_gettime":     108,
+	"timer_getoverrun":  109,
+	"timer_settime":     110,
+	"timer_delete":      111,
+	"clock_settime":     112,
+	"clock_gettime":     113,
+	"clock_getres":      114,
+	"clock_nanosleep":   115,
+	"syslog":            116,
+	"ptrace":            117,
+	"sched_getaffinity": 123,
+	"sched_yield":       124,
+	"restart_syscall":   128,
+	"kill":              129,
+	"tkill":             130,
+	"tgkill":            131,
+	"sigaltstack":       132,
+	"rt_sigsuspend":     133,
+	"rt_sigaction":      134,
+	"rt_sigprocmask":    135,
+	"rt_sigpending":     136,
+	"rt_sigtimedwait":   137,
+	"rt_sigreturn":      139,
+	"getpriority":       141,
+	"reboot":            142,
+	"getresuid":         148,
+	"getresgid":         150,
+	"times":             153,
+	"setpgid":           154,
+	"getpgid":           155,
+	"getsid":            156,
+	"getgroups":         158,
+	"uname":             160,
+	"sethostname":       161,
+	"setdomainname":     162,
+	"getrlimit":         163,
+	"getrusage":         165,
+	"umask":             166,
+	"prctl":             167,
+	"getcpu":            168,
+	"gettimeofday":      169,
+	"settimeofday":      170,
+	"adjtimex":          171,
+	"getpid":            172,
+	"getppid":           173,
+	"getuid":            174,
+	"geteuid":           175,
+	"getgid":            176,
+	"getegid":           177,
+	"gettid":            178,
+	"sysinfo":           179,
+	"brk":               214,
+	"munmap":            215,
+	"mremap":            216,
+	"add_key":           217,
+	"request_key":       218,
+	"keyctl":            219,
+	"clone":             220,
+	"execve":            221,
+	"mmap":              222,
+	"fadvise64":         223,
+	"swapon":            224,
+	"swapoff":           225,
+	"mprotect":          226,
+	"msync":             227,
+	"mlock":             228,
+	"munlock":           229,
+	"mincore":           232,
+	"madvise":           233,
+	"perf_event_open":   241,
+	"wait4":             260,
+	"prlimit64":         261,
+	"fanotify_init":     262,
+	"name_to_handle_at": 264,
+	"open_by_handle_at": 265,
+	"clock_adjtime":     266,
+	"setns":             268,
+	"process_vm_readv":  270,
+	"process_vm_writev": 271,
+	"kcmp":              272,
+	"finit_module":      273,
+	"renameat2":         276,
+	"getrandom":         278,
+	"memfd_create":      279,
+	"bpf":               280,
+	"userfaultfd":       282,
+	"membarrier":        283,
+	"copy_file_range":   285,
+	"pkey_mprotect":     288,
+	"pkey_alloc":        289,
+	"pkey_free":         290,
+	"statx":             291,
+	"rseq":              293,
+	"kexec_file_load":   294,
+	"io_uring_setup":    425,
+	"io_uring_enter":    426,
+	"io_uring_register": 427,
+	"open_tree":         428,
+	"move_mount":        429,
+	"fsopen":            430,
+	"fsconfig":          431,
+	"fsmount":           432,
+	"fspick":            433,
+	"clone3":            435,
+	"close_range":       436,
+	"faccessat2":        439,
+	"epoll_pwait2":      441,
+	"mount_setattr":     442,
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/Marattttt/personal-page/jsrunner/internal/config"
+	"github.com/Marattttt/personal-page/jsrunner/pkg/runtime"
 	"github.com/sethvargo/go-envconfig"
 )
 
@@ -26,6 +30,8 @@ type MQConfig struct {
 	RecvQ         string `env:"RECVQ, default=jsrunner"`
 	RespondQ      string `env:"RESPQ, default=jsrunner-response"`
 	RetriesOnFail int    `env:"RETRIES, default=5"`
+	// Prefix of queues with input of sessions, input of a session is read from <prefix>.<session id>
+	SessionQ string `env:"SESSIONQ, default=jsrunner-session"`
 }
 
 func (m MQConfig) URL() string {
@@ -36,6 +42,90 @@ type RuntimeConfig struct {
 	RunAs     *string `env:"USERNAME, noinit"`
 	RunAsPass *string `env:"PASS, noinit"`
 	Dir       string  `env:"DIR, default=./runtimedir"`
+
+	// Path of the node executable, found in PATH when empty
+	Node string `env:"NODE"`
+
+	// Amount of submissions run in parallel, each slot gets its own directory under Dir
+	Slots int `env:"SLOTS, default=1"`
+	// Comma separated users, one for every slot, take precedence over RunAs
+	SlotUsers []string `env:"SLOT_USERNAMES"`
+
+	// Wall-clock limit of a single run
+	Timeout time.Duration `env:"TIMEOUT, default=10s"`
+	// Limits of interactive sessions, which replace Timeout for them
+	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT, default=1m"`
+	SessionTimeout     time.Duration `env:"SESSION_TIMEOUT, default=5m"`
+	// Bytes of output kept from each of stdout and stderr
+	OutputStreamMax int `env:"OUTPUT_STREAM_MAX, default=1048576"`
+	// Bytes of output kept from stdout and stderr combined
+	OutputTotalMax int `env:"OUTPUT_TOTAL_MAX, default=1572864"`
+
+	// Parent cgroup v2 for runs, only used when any of the limits is set
+	Cgroup string `env:"CGROUP, default=/sys/fs/cgroup/jsrunner"`
+	// Memory limit in bytes
+	MemoryMax int64 `env:"MEMORY_MAX"`
+	// Amount of cpus, e.g. 0.5
+	CPUMax float64 `env:"CPU_MAX"`
+	// Limit on processes and threads
+	PidsMax int64 `env:"PIDS_MAX"`
+
+	// Run submissions in new network, pid, mount and ipc namespaces, with only loopback available.
+	// Linux-only, requires CAP_SYS_ADMIN
+	Namespaces bool `env:"NAMESPACES"`
+
+	// Path of the seccomp-exec helper, built from gorunner/cmd/seccomp-exec, node is started through it when set.
+	// The image ships it as /app/seccomp-exec
+	SeccompExec string `env:"SECCOMP_EXEC"`
+	// Syscalls allowed to node, deny for everything except dangerous ones, or strict
+	SeccompProfile string `env:"SECCOMP_PROFILE, default=deny"`
+
+	// Comma separated NAME:value pairs, that node starts with, variables of the runner are never passed on
+	BaseEnv map[string]string `env:"BASE_ENV, default=PATH:/usr/local/bin:/usr/bin:/bin"`
+	// Comma separated variables, that submissions can not set, a trailing * matches any suffix
+	ProtectedEnv []string `env:"PROTECTED_ENV, default=PATH,HOME,NODE_OPTIONS"`
+}
+
+// Directory of a single slot
+func (r RuntimeConfig) SlotDir(slot int) string {
+	return filepath.Join(r.Dir, fmt.Sprintf("slot-%d", slot))
+}
+
+// User to run submissions of a slot as, nil to run as the current user
+func (r RuntimeConfig) SlotUser(slot int) *string {
+	if len(r.SlotUsers) > 0 {
+		return &r.SlotUsers[slot]
+	}
+	return r.RunAs
+}
+
+func (r RuntimeConfig) Environment() runtime.Environment {
+	return runtime.Environment{
+		Base:      r.BaseEnv,
+		Protected: r.ProtectedEnv,
+	}
+}
+
+func (r RuntimeConfig) OutputLimits() runtime.OutputLimits {
+	return runtime.OutputLimits{
+		Stream: r.OutputStreamMax,
+		Total:  r.OutputTotalMax,
+	}
+}
+
+func (r RuntimeConfig) SessionLimits() runtime.SessionLimits {
+	return runtime.SessionLimits{
+		Idle:  r.SessionIdleTimeout,
+		Total: r.SessionTimeout,
+	}
+}
+
+func (r RuntimeConfig) Limits() runtime.Limits {
+	return runtime.Limits{
+		Memory: r.MemoryMax,
+		CPU:    r.CPUMax,
+		Pids:   r.PidsMax,
+	}
 }
 
 func CreateConfig(ctx context.Context) (*Config, error) {
@@ -44,5 +134,21 @@ func CreateConfig(ctx context.Context) (*Config, error) {
 		return nil, err
 	}
 
+	if conf.Runtime.Slots < 1 {
+		return nil, fmt.Errorf("at least 1 runtime slot is required, got %d", conf.Runtime.Slots)
+	}
+	if len(conf.Runtime.SlotUsers) > 0 && len(conf.Runtime.SlotUsers) != conf.Runtime.Slots {
+		return nil, fmt.Errorf("got %d slot users for %d slots", len(conf.Runtime.SlotUsers), conf.Runtime.Slots)
+	}
+	// Slots, that share a user, could read and overwrite files of each other
+	for i, user := range conf.Runtime.SlotUsers {
+		if slices.Index(conf.Runtime.SlotUsers[:i], user) >= 0 {
+			return nil, fmt.Errorf("slot user %q is given more than once", user)
+		}
+	}
+	if _, err := runtime.ParseSeccompProfile(conf.Runtime.SeccompProfile); err != nil {
+		return nil, err
+	}
+
 	return &conf, nil
 }
@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/user"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,6 +21,16 @@ import (
 
 type Req struct {
 	Code string `json:"code"`
+
+	// Passed to the script, never to the shell that starts it
+	Stdin string   `json:"stdin"`
+	Args  []string `json:"args"`
+	// Set over the base environment of the runner, protected variables can not be set
+	Env map[string]string `json:"env"`
+
+	// Id of a session, chosen by the client. When set, the script is run interactively,
+	// with input read from the queue of the session and output published in chunks
+	Session string `json:"session"`
 }
 
 type Resp struct {
@@ -25,10 +38,39 @@ type Resp struct {
 	Stderr   []byte        `json:"stderr"`
 	TimeTook time.Duration `json:"timeTook"`
 	ExitCode int           `json:"exitCode"`
+	// Whether outputs were cut short because of output limits
+	StdoutTruncated bool `json:"stdoutTruncated,omitempty"`
+	StderrTruncated bool `json:"stderrTruncated,omitempty"`
+	// Whether the run was killed after reaching the timeout
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Resource limit that caused the run to be killed
+	LimitHit     string `json:"limitHit,omitempty"`
+	CPUThrottled bool   `json:"cpuThrottled,omitempty"`
+	// Whether node was killed for a syscall, that the seccomp profile does not allow
+	SyscallBlocked bool `json:"syscallBlocked,omitempty"`
+	// Set when the submission was rejected without running
+	Error string `json:"error,omitempty"`
+
+	// Output of a session, messages with a chunk precede the final response
+	Chunk *runtime.OutputChunk `json:"chunk,omitempty"`
+	// Amount of chunks, that preceded the final response of a session
+	Streamed int `json:"streamed,omitempty"`
+	// Id of the session, that the chunk or the result belongs to
+	Session string `json:"session,omitempty"`
+	// Whether the session was stopped after going without input or output for too long
+	IdleTimedOut bool `json:"idleTimedOut,omitempty"`
+
+	// Detected at startup, set on every response
+	Versions Versions `json:"versions"`
 
 	CorrelationID string `json:"-"`
 }
 
+// Versions of the tools, that run submissions
+type Versions struct {
+	Node string `json:"node"`
+}
+
 func main() {
 	appctx, appcancel := context.WithCancel(context.TODO())
 	defer appcancel()
@@ -44,6 +86,16 @@ func main() {
 
 	checkFatal(conf.Apply(), "Could not apply config")
 
+	node, err := createNode(appctx, *conf)
+	checkFatal(err, "Resolving node")
+	slog.Info("Using node", slog.String("path", node.Path), slog.String("version", node.Version))
+
+	slots, err := createSlots(*conf, node)
+	checkFatal(err, "Cretaing runtime")
+
+	// Nothing is consumed until every slot is known to run scripts
+	checkFatal(selfTest(appctx, slots), "Self test failed")
+
 	conn, err := amqp091.Dial(conf.MQ.URL())
 	checkFatal(err, "Dialling "+conf.MQ.URL())
 
@@ -51,14 +103,14 @@ func main() {
 	var retries atomic.Int32
 
 	go func() {
-		consume(appctx, conf, conn, sendmsg, &retries)
+		consume(appctx, conf, conn, slots, sendmsg, &retries)
 		// Closing the sendmsg channel signals to finish reading from it and stop the producer
 		// goroutine, which leads to all remaining messages being sent to mq before shutdown
 		close(sendmsg)
 	}()
 
 	go func() {
-		produce(appctx, conf, conn, sendmsg, &retries)
+		produce(appctx, conf, conn, Versions{Node: node.Version}, sendmsg, &retries)
 		slog.Info("Stopped message production")
 		appcancel()
 	}()
@@ -74,20 +126,23 @@ func checkFatal(err error, msg string) {
 	}
 }
 
-func consume(ctx context.Context, conf *Config, conn *amqp091.Connection, send chan Resp, retryCounter *atomic.Int32) {
+func consume(ctx context.Context, conf *Config, conn *amqp091.Connection, slots chan Runtime, send chan Resp, retryCounter *atomic.Int32) {
 	ch, err := conn.Channel()
-	// Cannot continue operationg on an error of such level
+	// Cannot continue operationg on an error of such level
 	checkFatal(err, "Obtaining a channel from MQ")
 
+	// Never hold more messages than there are free slots to run them
+	checkFatal(ch.Qos(conf.Runtime.Slots, 0, false), "Setting prefetch count")
+
 	q, err := ch.QueueDeclare(conf.MQ.RecvQ, true, false, false, false, nil)
 	checkFatal(err, "Declaring receive queue")
 
 	d, err := ch.ConsumeWithContext(ctx, q.Name, "", false, false, false, false, nil)
 	checkFatal(err, "Creating a consume channel")
 
-	runtimeLock := sync.Mutex{}
-	run, err := createRuntime(*conf, &runtimeLock)
-	checkFatal(err, "Cretaing runtime")
+	// Runs, that may still send a response
+	var running sync.WaitGroup
+	defer running.Wait()
 
 	for msg := range d {
 		if retryCounter.Load() > int32(conf.MQ.RetriesOnFail) {
@@ -103,71 +158,232 @@ func consume(ctx context.Context, conf *Config, conn *amqp091.Connection, send c
 			continue
 		}
 
-		defer func() {
-			retryCounter.Add(1)
-			if cause := recover(); cause != nil {
-				if err, ok := cause.(error); ok {
-					slog.Error("Recovered from panic in main/consume (error)", slog.String("err", err.Error()))
-				} else {
-					slog.Error("Recovered from panic in main/consume (not an error)", slog.Any("cause", cause))
+		// Wait for a free slot
+		run := <-slots
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer func() { slots <- run }()
+
+			// Chunks of a session are sent from the same goroutine one after another, so they reach the queue in order
+			var streamed int
+
+			defer func() {
+				if cause := recover(); cause != nil {
+					retryCounter.Add(1)
+					if err, ok := cause.(error); ok {
+						slog.Error("Recovered from panic in main/consume (error)", slog.String("err", err.Error()))
+					} else {
+						slog.Error("Recovered from panic in main/consume (not an error)", slog.Any("cause", cause))
+					}
+					msg.Reject(false)
 				}
+			}()
+
+			rex, err := execute(ctx, conn, conf.MQ.SessionQ, run, req, func(chunk runtime.OutputChunk) {
+				send <- Resp{Chunk: &chunk, Session: req.Session, CorrelationID: msg.CorrelationId}
+				streamed++
+			})
+			// Requeueing a submission that is invalid by itself would never succeed
+			if errors.Is(err, runtime.ErrInvalidSubmission) {
+				slog.Warn("Rejected an invalid submission", slog.String("err", err.Error()))
+				send <- Resp{Error: err.Error(), Session: req.Session, CorrelationID: msg.CorrelationId}
+				msg.Ack(false)
+				return
+			}
+			// Input of a session was already consumed, a requeued one would run without it
+			if err != nil && req.Session != "" {
+				slog.Error("Could not run a session", slog.String("session", req.Session), slog.String("err", err.Error()))
+				send <- Resp{Error: err.Error(), Session: req.Session, CorrelationID: msg.CorrelationId}
+				msg.Ack(false)
+				return
 			}
+			if err != nil {
+				msg.Reject(true)
+				retryCounter.Add(1)
+				slog.Error("Could not execute code from mq", slog.String("err", err.Error()))
+				return
+			}
+
+			resp := Resp{
+				Stdout:   rex.Stdout,
+				Stderr:   rex.Stderr,
+				ExitCode: rex.ExitCode,
+				TimeTook: rex.TimeTook,
+
+				StdoutTruncated: rex.StdoutTruncated,
+				StderrTruncated: rex.StderrTruncated,
+
+				TimedOut:       rex.TimedOut,
+				LimitHit:       rex.LimitHit,
+				CPUThrottled:   rex.CPUThrottled,
+				SyscallBlocked: rex.SyscallBlocked,
+
+				Streamed:     streamed,
+				Session:      req.Session,
+				IdleTimedOut: rex.IdleTimedOut,
+
+				CorrelationID: msg.CorrelationId,
+			}
+
+			send <- resp
+
+			msg.Ack(false)
 		}()
+	}
+}
+
+// Run a script of a request, as a session, if it is one, passing its output to onOutput
+func execute(ctx context.Context, conn *amqp091.Connection, sessionQ string, run Runtime, req Req, onOutput func(runtime.OutputChunk)) (*runtime.RunResult, error) {
+	input := runtime.Input{Stdin: []byte(req.Stdin), Args: req.Args, Env: req.Env}
+	if req.Session == "" {
+		return run.RunWithInput(ctx, req.Code, input)
+	}
 
-		rex, err := run.Run(ctx, req.Code)
+	// Stops reading input of the session
+	done := make(chan struct{})
+	defer close(done)
+
+	stdin, err := sessionInput(conn, sessionQ, req, done)
+	if err != nil {
+		return nil, err
+	}
+
+	return run.WithOutputHandler(onOutput).RunSession(ctx, req.Code, input, stdin)
+}
+
+type Runtime interface {
+	RunWithInput(ctx context.Context, code string, input runtime.Input) (*runtime.RunResult, error)
+	RunSession(ctx context.Context, code string, input runtime.Input, stdin <-chan []byte) (*runtime.RunResult, error)
+	WithOutputHandler(handler func(runtime.OutputChunk)) runtime.Runtime
+	SelfTest(ctx context.Context) error
+}
+
+// Resolve the configured node, or the one found in PATH when there is none
+func createNode(ctx context.Context, conf Config) (runtime.Node, error) {
+	if conf.Runtime.Node == "" {
+		return runtime.DetectNode(ctx)
+	}
+
+	return runtime.NewNode(ctx, conf.Runtime.Node)
+}
+
+// Run the self test of every slot, each of them may run as a different user
+func selfTest(ctx context.Context, slots chan Runtime) error {
+	for slot := range cap(slots) {
+		run := <-slots
+		err := run.SelfTest(ctx)
+		slots <- run
 		if err != nil {
-			msg.Reject(true)
-			retryCounter.Add(1)
-			slog.Error("Could not execute code from mq", slog.String("err", err.Error()))
-			continue
+			return fmt.Errorf("slot %d: %w", slot, err)
 		}
+	}
 
-		resp := Resp{
-			Stdout:   rex.Stdout,
-			Stderr:   rex.Stderr,
-			ExitCode: rex.ExitCode,
-			TimeTook: rex.TimeTook,
+	slog.Info("Passed self test", slog.Int("slots", cap(slots)))
+	return nil
+}
 
-			CorrelationID: msg.CorrelationId,
-		}
+// Create a runtime for every slot, a runtime is taken from the channel for a run and returned after it
+func createSlots(conf Config, node runtime.Node) (chan Runtime, error) {
+	if limits := conf.Runtime.Limits(); limits != (runtime.Limits{}) {
+		slog.Info("Limiting resources of runs", slog.String("cgroup", conf.Runtime.Cgroup), slog.Any("limits", limits))
+	}
 
-		send <- resp
+	if conf.Runtime.Namespaces {
+		slog.Info("Isolating runs in namespaces")
+	}
 
-		msg.Ack(false)
+	if len(conf.Runtime.SlotUsers) == 0 && conf.Runtime.Slots > 1 {
+		slog.Warn("Runtime slots share a user, so their runs can access each other's files")
 	}
-}
 
-type Runtime interface {
-	Run(ctx context.Context, code string) (*runtime.RunResult, error)
+	slots := make(chan Runtime, conf.Runtime.Slots)
+	for slot := range conf.Runtime.Slots {
+		run, err := createRuntime(conf, slot, node)
+		if err != nil {
+			return nil, fmt.Errorf("creating slot %d: %w", slot, err)
+		}
+		slots <- run
+	}
+
+	return slots, nil
 }
 
 // Function may panic due to invalid app configuration
-func createRuntime(conf Config, runtimeLock sync.Locker) (Runtime, error) {
+func createRuntime(conf Config, slot int, node runtime.Node) (Runtime, error) {
+	username := conf.Runtime.SlotUser(slot)
+
+	env, err := createEnv(conf, username)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Runtime.Namespaces {
+		env = runtime.NewNamespaceEnv(env)
+	}
+
+	run := runtime.NewRuntime(&sync.Mutex{}, conf.Runtime.SlotDir(slot), env).
+		WithLimits(conf.Runtime.Cgroup, conf.Runtime.Limits()).
+		WithTimeout(conf.Runtime.Timeout).
+		WithOutputLimits(conf.Runtime.OutputLimits()).
+		WithEnvironment(conf.Runtime.Environment()).
+		WithSessionLimits(conf.Runtime.SessionLimits()).
+		WithNode(node)
+
+	if conf.Runtime.SeccompExec != "" {
+		// Validated when creating the config
+		profile, _ := runtime.ParseSeccompProfile(conf.Runtime.SeccompProfile)
+		run = run.WithSeccomp(conf.Runtime.SeccompExec, profile)
+	}
+
+	if username != nil {
+		owner, err := user.Lookup(*username)
+		if err != nil {
+			return nil, fmt.Errorf("looking up %s: %w", *username, err)
+		}
+
+		uid, err := strconv.Atoi(owner.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("parsing uid of %s: %w", *username, err)
+		}
+		gid, err := strconv.Atoi(owner.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("parsing gid of %s: %w", *username, err)
+		}
+
+		run = run.WithOwner(uid, gid)
+	}
+
+	return run, nil
+}
+
+func createEnv(conf Config, username *string) (runtime.EnvProvider, error) {
 	// Run as same user
-	if conf.Runtime.RunAs == nil {
+	if username == nil {
 		slog.Info("Creating same user environment")
 		env := userenv.SameUserEnv{}
 
 		if conf.Mode != "debug" {
 			return nil, fmt.Errorf("Not specifying user to run the application as is not allowed outside of debug mode")
 		}
-		return runtime.NewRuntime(runtimeLock, conf.Runtime.Dir, env), nil
+		return env, nil
 	}
 
 	if conf.Runtime.RunAsPass != nil {
 		slog.Warn("Password authentication for a user is not supported")
 	}
 
-	slog.Info("Creating environment for a different user", slog.String("runAs", *conf.Runtime.RunAs))
-	diffUserEnv, err := userenv.NewDiffUserEnv(*conf.Runtime.RunAs, nil)
+	slog.Info("Creating environment for a different user", slog.String("runAs", *username))
+	diffUserEnv, err := userenv.NewDiffUserEnv(*username, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return runtime.NewRuntime(runtimeLock, conf.Runtime.Dir, diffUserEnv), nil
+	return diffUserEnv, nil
 }
 
-func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, sendCh chan Resp, retryCounter *atomic.Int32) {
+// Publish responses, setting versions on each of them
+func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, versions Versions, sendCh chan Resp, retryCounter *atomic.Int32) {
 	ch, err := conn.Channel()
 	// Cannot continue operationg on an error of such level
 	checkFatal(err, "Obtaining a channel from MQ")
@@ -186,6 +402,7 @@ func produce(ctx context.Context, conf *Config, conn *amqp091.Connection, sendCh
 			slog.Warn("Message production context cancelled")
 			return
 		case r := <-sendCh:
+			r.Versions = versions
 			marshalled, err := json.Marshal(r)
 			if err != nil {
 				slog.Error("Could not marshall message", slog.String("err", err.Error()), slog.Any("val", r))
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/Marattttt/personal-page/jsrunner/pkg/runtime"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Queues of sessions, that were never consumed from, are deleted after this long
+//
+// Clients declare the queue before starting a session, so the arguments have to match theirs
+const sessionQueueExpiry = 10 * time.Minute
+
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// A message in the queue of a session
+type SessionInput struct {
+	// Written to stdin of the script
+	Stdin string `json:"stdin"`
+	// Close stdin of the script after writing Stdin, later messages are ignored
+	Close bool `json:"close"`
+}
+
+// Name of the queue with input of a session
+func sessionQueue(prefix string, id string) string {
+	return prefix + "." + id
+}
+
+// Declare the queue of a session, which is deleted, once it is no longer consumed from
+func declareSessionQueue(ch *amqp091.Channel, name string) (amqp091.Queue, error) {
+	return ch.QueueDeclare(name, false, true, false, false, amqp091.Table{
+		"x-expires": int32(sessionQueueExpiry.Milliseconds()),
+	})
+}
+
+// Receive input of a session from its queue, until input is closed or done is closed
+//
+// Returns nil for requests, that are not sessions
+func sessionInput(conn *amqp091.Connection, prefix string, req Req, done <-chan struct{}) (<-chan []byte, error) {
+	if req.Session == "" {
+		return nil, nil
+	}
+	if !sessionIDRe.MatchString(req.Session) {
+		return nil, fmt.Errorf("%w: invalid session id %q", runtime.ErrInvalidSubmission, req.Session)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("obtaining a channel for session input: %w", err)
+	}
+
+	q, err := declareSessionQueue(ch, sessionQueue(prefix, req.Session))
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("declaring session queue: %w", err)
+	}
+
+	d, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		// The queue is consumed exclusively, so the id belongs to a session, that is still running
+		var amqpErr *amqp091.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.ResourceLocked {
+			return nil, fmt.Errorf("%w: session %q is already running", runtime.ErrInvalidSubmission, req.Session)
+		}
+		return nil, fmt.Errorf("consuming session input: %w", err)
+	}
+
+	stdin := make(chan []byte)
+
+	go func() {
+		// Cancels the consumer, after which the queue is deleted
+		defer ch.Close()
+
+		for {
+			select {
+			case msg, ok := <-d:
+				if !ok {
+					close(stdin)
+					return
+				}
+
+				var in SessionInput
+				if err := json.Unmarshal(msg.Body, &in); err != nil {
+					slog.Warn("Could not decode session input", slog.String("session", req.Session), slog.String("err", err.Error()))
+					continue
+				}
+
+				if len(in.Stdin) > 0 {
+					select {
+					case stdin <- []byte(in.Stdin):
+					case <-done:
+						return
+					}
+				}
+
+				if in.Close {
+					close(stdin)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return stdin, nil
+}
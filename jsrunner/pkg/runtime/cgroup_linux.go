@@ -0,0 +1,263 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Period over which cpu quota is calculated, in microseconds
+	cpuPeriod = 100_000
+
+	// How often cgroup events are checked during a run
+	cgroupPollInterval = 50 * time.Millisecond
+)
+
+// A cgroup v2 created for a single run
+type cgroup struct {
+	path string
+	// Open directory, used to start a process directly inside the cgroup
+	dir *os.File
+
+	// Closed to stop watching for events
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu  sync.Mutex
+	hit string
+}
+
+// Create a new cgroup under parent and apply limits to it
+//
+// Controllers for all limits are enabled in parent, so parent must not contain any processes itself
+func newCgroup(parent string, limits Limits) (*cgroup, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("creating parent cgroup: %w", err)
+	}
+
+	if err := enableControllers(parent, limits); err != nil {
+		return nil, fmt.Errorf("enabling controllers in %s: %w", parent, err)
+	}
+
+	path, err := os.MkdirTemp(parent, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("creating cgroup: %w", err)
+	}
+
+	cg := &cgroup{path: path, stop: make(chan struct{})}
+
+	if err := cg.apply(limits); err != nil {
+		cg.remove()
+		return nil, err
+	}
+
+	cg.dir, err = os.Open(path)
+	if err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("opening cgroup: %w", err)
+	}
+
+	slog.Debug("Created cgroup", slog.String("path", path), slog.Any("limits", limits))
+
+	return cg, nil
+}
+
+func enableControllers(parent string, limits Limits) error {
+	var controllers []string
+	if limits.Memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if limits.CPU > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if limits.Pids > 0 {
+		controllers = append(controllers, "+pids")
+	}
+
+	return os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0)
+}
+
+func (c *cgroup) apply(limits Limits) error {
+	if limits.Memory > 0 {
+		if err := c.write("memory.max", strconv.FormatInt(limits.Memory, 10)); err != nil {
+			return err
+		}
+		// Swap is not always available, but when it is, it would allow to exceed the limit
+		if err := c.write("memory.swap.max", "0"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Kill all processes together, not only the biggest one
+		if err := c.write("memory.oom.group", "1"); err != nil {
+			return err
+		}
+	}
+
+	if limits.CPU > 0 {
+		quota := int64(limits.CPU * cpuPeriod)
+		if err := c.write("cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)); err != nil {
+			return err
+		}
+	}
+
+	if limits.Pids > 0 {
+		if err := c.write("pids.max", strconv.FormatInt(limits.Pids, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Make cmd start inside the cgroup
+func (c *cgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// Start killing the cgroup as soon as any of its limits is hit
+func (c *cgroup) watch() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(cgroupPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				c.checkEvents()
+				return
+			case <-ticker.C:
+				if c.checkEvents() {
+					slog.Warn("Run hit a resource limit", slog.String("limit", c.limitHit()))
+					c.kill()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Record the first limit that was hit, if any, and report whether one was
+func (c *cgroup) checkEvents() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hit != "" {
+		return true
+	}
+
+	switch {
+	case c.event("memory.events", "oom_kill") > 0 || c.event("memory.events", "oom_group_kill") > 0:
+		c.hit = LimitMemory
+	case c.event("pids.events", "max") > 0:
+		c.hit = LimitPids
+	}
+
+	return c.hit != ""
+}
+
+func (c *cgroup) limitHit() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hit
+}
+
+// Whether any of the processes was throttled due to the cpu quota
+func (c *cgroup) throttled() bool {
+	return c.event("cpu.stat", "nr_throttled") > 0
+}
+
+// Kill all processes in the cgroup
+func (c *cgroup) kill() {
+	if err := c.write("cgroup.kill", "1"); err == nil {
+		return
+	}
+
+	// cgroup.kill is only available since linux 5.14
+	procs, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+	if err != nil {
+		slog.Error("Could not list processes of a cgroup", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, line := range strings.Fields(string(procs)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
+// Stop watching for events, after which the limit that was hit is final
+func (c *cgroup) finish() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.wg.Wait()
+}
+
+// Stop watching, kill every remaining process and remove the cgroup
+func (c *cgroup) remove() {
+	c.finish()
+
+	if c.dir != nil {
+		c.dir.Close()
+	}
+
+	// A cgroup can only be removed after all of its processes have exited
+	for range 20 {
+		c.kill()
+		if err := os.Remove(c.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(cgroupPollInterval)
+	}
+
+	slog.Error("Could not remove cgroup", slog.String("path", c.path))
+}
+
+func (c *cgroup) write(file string, value string) error {
+	if err := os.WriteFile(filepath.Join(c.path, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("writing %s: %w", file, err)
+	}
+	return nil
+}
+
+// Read a value from a flat keyed file, e.g. memory.events
+//
+// Missing files and keys are treated as zero values
+func (c *cgroup) event(file string, key string) int64 {
+	content, err := os.ReadFile(filepath.Join(c.path, file))
+	if err != nil {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == key {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+
+	return 0
+}
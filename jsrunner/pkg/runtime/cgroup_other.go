@@ -0,0 +1,23 @@
+//go:build !linux
+
+package runtime
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Resource limits rely on cgroup v2, which is linux-only
+type cgroup struct{}
+
+func newCgroup(parent string, limits Limits) (*cgroup, error) {
+	return nil, errors.New("resource limits are only supported on linux")
+}
+
+func (c *cgroup) attach(cmd *exec.Cmd) {}
+func (c *cgroup) watch()               {}
+func (c *cgroup) finish()              {}
+func (c *cgroup) remove()              {}
+func (c *cgroup) kill()                {}
+func (c *cgroup) limitHit() string     { return "" }
+func (c *cgroup) throttled() bool      { return false }
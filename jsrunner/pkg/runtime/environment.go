@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// Limits on variables of a single run
+	maxEnv    = 64
+	maxEnvLen = 64 << 10
+)
+
+// Variables, that are always protected, since they change how programs are loaded
+var loaderEnv = []string{"LD_*"}
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Environment of node, which is never inherited from the runner
+//
+// The zero value starts programs with no variables at all, see DefaultEnvironment for a minimal one
+type Environment struct {
+	// Variables, that every script starts with, e.g. PATH
+	Base map[string]string
+	// Variables, that submissions can not set, a trailing * matches any suffix, e.g. NODE_*
+	Protected []string
+}
+
+// Environment of a new runtime, where scripts only get a PATH, which they can not change
+func DefaultEnvironment() Environment {
+	return Environment{
+		Base:      map[string]string{"PATH": "/usr/local/bin:/usr/bin:/bin"},
+		Protected: []string{"PATH"},
+	}
+}
+
+// Check that variables of a submission can be passed to a script
+func validateEnv(vars map[string]string) error {
+	if len(vars) > maxEnv {
+		return fmt.Errorf("%w: too many environment variables (%d), at most %d are allowed", ErrInvalidSubmission, len(vars), maxEnv)
+	}
+
+	total := 0
+	for name, value := range vars {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("%w: invalid environment variable name %q", ErrInvalidSubmission, name)
+		}
+		// Variables are passed as C strings
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("%w: environment variables must not contain null bytes", ErrInvalidSubmission)
+		}
+		total += len(name) + len(value)
+	}
+	if total > maxEnvLen {
+		return fmt.Errorf("%w: environment variables are %d bytes, at most %d are allowed", ErrInvalidSubmission, total, maxEnvLen)
+	}
+
+	return nil
+}
+
+// Whether a submission may not set a variable
+func (e Environment) protected(name string) bool {
+	for _, pattern := range append(slices.Clone(loaderEnv), e.Protected...) {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Variables of a script in the form of NAME=value, sorted by name: the base ones, overridden by the ones of a submission
+func (e Environment) merge(vars map[string]string) ([]string, error) {
+	merged := maps.Clone(e.Base)
+	if merged == nil {
+		merged = make(map[string]string, len(vars))
+	}
+
+	for name, value := range vars {
+		if e.protected(name) {
+			return nil, fmt.Errorf("%w: environment variable %s is protected", ErrInvalidSubmission, name)
+		}
+		merged[name] = value
+	}
+
+	env := make([]string, 0, len(merged))
+	for _, name := range slices.Sorted(maps.Keys(merged)) {
+		env = append(env, name+"="+merged[name])
+	}
+
+	return env, nil
+}
+
+// Arguments, that start a program with only the variables of env
+func isolate(env []string, program ...string) []string {
+	return append(append([]string{"env", "-i"}, env...), program...)
+}
@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned (wrapped) when a submission can not be run because of the submission itself,
+// as opposed to a failure of the runtime
+var ErrInvalidSubmission = errors.New("invalid submission")
+
+const (
+	// File with stdin of a run, relative to the run directory
+	stdinName = ".jsrunner-stdin"
+
+	// Limits on input of a single run
+	maxStdin   = 1 << 20
+	maxArgs    = 64
+	maxArgsLen = 64 << 10
+)
+
+// Input passed to the script of a submission
+type Input struct {
+	// Contents of stdin, the script reads an immediate EOF when empty
+	Stdin []byte
+	// Command-line arguments, available after the script path in process.argv
+	Args []string
+	// Environment variables, that are set over the base environment of the runtime
+	Env map[string]string
+}
+
+// Check that input fits the limits and can be passed to a script
+func (in Input) Validate() error {
+	if len(in.Stdin) > maxStdin {
+		return fmt.Errorf("%w: stdin is %d bytes, at most %d are allowed", ErrInvalidSubmission, len(in.Stdin), maxStdin)
+	}
+	if len(in.Args) > maxArgs {
+		return fmt.Errorf("%w: too many arguments (%d), at most %d are allowed", ErrInvalidSubmission, len(in.Args), maxArgs)
+	}
+
+	total := 0
+	for _, arg := range in.Args {
+		// Arguments are passed as C strings
+		if strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("%w: arguments must not contain null bytes", ErrInvalidSubmission)
+		}
+		total += len(arg)
+	}
+	if total > maxArgsLen {
+		return fmt.Errorf("%w: arguments are %d bytes, at most %d are allowed", ErrInvalidSubmission, total, maxArgsLen)
+	}
+
+	return validateEnv(in.Env)
+}
+
+// Shell command line, that executes a program, e.g. node with a script, with the input
+//
+// Every argument is quoted, and stdin is redirected from a file written by writeStdin,
+// so neither can change the command line itself
+func (in Input) command(program ...string) string {
+	// Without a redirect the script would read the rest of the shell's own stdin
+	if len(in.Stdin) == 0 {
+		return in.commandWithStdin("/dev/null", program...)
+	}
+	return in.commandWithStdin(stdinName, program...)
+}
+
+// Shell command line, that executes a program with stdin redirected from a file, ignoring in.Stdin
+func (in Input) commandWithStdin(file string, program ...string) string {
+	command := "exec"
+	for _, arg := range append(program, in.Args...) {
+		command += " " + shellQuote(arg)
+	}
+
+	return command + " < " + shellQuote(file)
+}
+
+// Write stdin to the run directory, if there is any
+func (in Input) writeStdin(root string) error {
+	if len(in.Stdin) == 0 {
+		return nil
+	}
+
+	// Readable by everyone, since the script may run as another user
+	if err := os.WriteFile(filepath.Join(root, stdinName), in.Stdin, 0644); err != nil {
+		return fmt.Errorf("writing stdin: %w", err)
+	}
+
+	return nil
+}
+
+// Quote a string to be passed to a posix shell as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
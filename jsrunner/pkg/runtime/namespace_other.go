@@ -0,0 +1,22 @@
+//go:build !linux
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// Namespaces are linux-only
+type NamespaceEnv struct {
+	inner EnvProvider
+}
+
+func NewNamespaceEnv(inner EnvProvider) NamespaceEnv {
+	return NamespaceEnv{inner: inner}
+}
+
+func (n NamespaceEnv) Login(ctx context.Context) (*exec.Cmd, error) {
+	return nil, errors.New("namespace isolation is only supported on linux")
+}
@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var nodeVersionRe = regexp.MustCompile(`^v\d+\.\d+\.\d+`)
+
+// Node executable, that runs scripts
+type Node struct {
+	// Absolute path of the executable
+	Path string
+	// Version reported by node --version, e.g. v20.11.1
+	Version string
+}
+
+// Find node in PATH and check that it runs
+func DetectNode(ctx context.Context) (Node, error) {
+	nodePath, err := exec.LookPath("node")
+	if err != nil {
+		return Node{}, fmt.Errorf("looking up node: %w", err)
+	}
+
+	return NewNode(ctx, nodePath)
+}
+
+// Check that the node executable at nodePath runs and get its version
+func NewNode(ctx context.Context, nodePath string) (Node, error) {
+	out, err := exec.CommandContext(ctx, nodePath, "--version").Output()
+	if err != nil {
+		return Node{}, fmt.Errorf("running %s --version: %w", nodePath, err)
+	}
+
+	version := strings.TrimSpace(string(out))
+	if !nodeVersionRe.MatchString(version) {
+		return Node{}, fmt.Errorf("unexpected version of %s: %q", nodePath, version)
+	}
+
+	return Node{Path: nodePath, Version: version}, nil
+}
+
+// Node found in PATH, used by runtimes without a configured one
+//
+// Detected once, so that runs do not look for node every time
+var pathNode = sync.OnceValues(func() (Node, error) {
+	return DetectNode(context.Background())
+})
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Limits on the amount of output kept from a single run
+//
+// Zero values mean no limit
+type OutputLimits struct {
+	// Maximum bytes kept from each of stdout and stderr
+	Stream int
+	// Maximum bytes kept from stdout and stderr combined
+	Total int
+}
+
+// Names of outputs in chunks
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// A piece of output of a script, that is passed on while the script runs
+type OutputChunk struct {
+	// StreamStdout or StreamStderr
+	Stream string `json:"stream"`
+	// Order of the chunk among chunks of both outputs of a run, starting from 0
+	Seq  int    `json:"seq"`
+	Data []byte `json:"data"`
+}
+
+// Collects outputs of a run, until any of the limits is reached
+//
+// Output past the limits is discarded, and onLimit is called once,
+// so the run can be stopped early
+type outputCollector struct {
+	limits  OutputLimits
+	onLimit func()
+	// Called with every piece of output, that is kept, nil for none
+	onOutput func(OutputChunk)
+
+	mu      sync.Mutex
+	total   int
+	limited bool
+	// Sequence number of the next chunk
+	seq int
+
+	stdout outputStream
+	stderr outputStream
+}
+
+// A single output of a run
+type outputStream struct {
+	c    *outputCollector
+	name string
+
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func newOutputCollector(limits OutputLimits, onLimit func()) *outputCollector {
+	c := &outputCollector{limits: limits, onLimit: onLimit}
+	c.stdout.c, c.stdout.name = c, StreamStdout
+	c.stderr.c, c.stderr.name = c, StreamStderr
+	return c
+}
+
+// Keep as much of p as the limits allow
+//
+// Never returns an error, so that a writer is never blocked on a full pipe
+// while the run is being stopped
+func (s *outputStream) Write(p []byte) (int, error) {
+	c := s.c
+
+	c.mu.Lock()
+
+	allowed := len(p)
+	if c.limits.Stream > 0 {
+		allowed = min(allowed, c.limits.Stream-s.buf.Len())
+	}
+	if c.limits.Total > 0 {
+		allowed = min(allowed, c.limits.Total-c.total)
+	}
+	allowed = max(allowed, 0)
+
+	s.buf.Write(p[:allowed])
+	c.total += allowed
+
+	// Handled under the lock, so that chunks are passed on in the order of their numbers
+	if c.onOutput != nil && allowed > 0 {
+		c.onOutput(OutputChunk{Stream: s.name, Seq: c.seq, Data: bytes.Clone(p[:allowed])})
+		c.seq++
+	}
+
+	// Only the first write over a limit stops the run
+	stop := false
+	if allowed < len(p) {
+		s.truncated = true
+		stop = !c.limited
+		c.limited = true
+	}
+
+	c.mu.Unlock()
+
+	if stop {
+		c.onLimit()
+	}
+
+	return len(p), nil
+}
+
+// Collected output, nil if nothing was written
+func (s *outputStream) bytes() []byte {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	return s.buf.Bytes()
+}
+
+func (s *outputStream) isTruncated() bool {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	return s.truncated
+}
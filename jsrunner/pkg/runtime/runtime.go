@@ -1,15 +1,14 @@
 package runtime
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path"
-	"strings"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -19,6 +18,21 @@ type RunResult struct {
 	Stderr   []byte
 	ExitCode int
 	TimeTook time.Duration
+
+	// Whether outputs were cut short because of output limits
+	StdoutTruncated bool
+	StderrTruncated bool
+
+	// Whether the run was killed after reaching the runtime's timeout
+	TimedOut bool
+	// Resource limit, because of which the run was killed, if any
+	LimitHit string
+	// Whether the run was slowed down by the cpu limit
+	CPUThrottled bool
+	// Whether node was killed for a syscall, that the seccomp profile does not allow
+	SyscallBlocked bool
+	// Whether a session was stopped after going without input or output for too long
+	IdleTimedOut bool
 }
 
 // Provides methods for managing a user-specific environment
@@ -36,112 +50,225 @@ type Runtime struct {
 	lck  sync.Locker
 	root string
 	env  EnvProvider
+
+	limits Limits
+	// Parent cgroup, under which a cgroup for every run is created
+	cgroupRoot string
+	// Wall-clock limit of a single run, 0 for none
+	timeout time.Duration
+	// Limits of kept output, the run is stopped once they are reached
+	outputLimits OutputLimits
+	// User, that is given exclusive access to the run directory, nil to leave it open to everyone
+	owner *dirOwner
+	// Filter of syscalls of node, nil for none
+	seccomp *seccompExec
+	// Variables, that node starts with
+	environment Environment
+	// Executable, that runs scripts, nil to use the one found in PATH
+	node *Node
+	// Receives output of the script while it runs, nil for none
+	onOutput func(OutputChunk)
+	// Limits of interactive sessions
+	sessionLimits SessionLimits
+}
+
+type seccompExec struct {
+	// Path of the seccomp-exec helper of gorunner
+	helper  string
+	profile SeccompProfile
+}
+
+// Profile of the seccomp-exec helper, the same as the ones of gorunner/pkg/seccomp
+type SeccompProfile string
+
+const (
+	// Everything except syscalls, that manipulate the system or other processes
+	SeccompDeny SeccompProfile = "deny"
+	// Only syscalls, that are needed to compute and work with files, networking is not allowed
+	SeccompStrict SeccompProfile = "strict"
+)
+
+// Parse a profile by name, an empty name means SeccompDeny
+func ParseSeccompProfile(name string) (SeccompProfile, error) {
+	switch SeccompProfile(name) {
+	case "", SeccompDeny:
+		return SeccompDeny, nil
+	case SeccompStrict:
+		return SeccompStrict, nil
+	default:
+		return "", fmt.Errorf("unknown seccomp profile %q, expected %s or %s", name, SeccompDeny, SeccompStrict)
+	}
+}
+
+type dirOwner struct {
+	uid int
+	gid int
 }
 
 func NewRuntime(lck sync.Locker, runDir string, provider EnvProvider) Runtime {
+	// The directory is accessed from a login shell, that does not share the working directory
+	if abs, err := filepath.Abs(runDir); err == nil {
+		runDir = abs
+	}
+
 	return Runtime{
 		lck:  lck,
 		env:  provider,
 		root: runDir,
+
+		environment: DefaultEnvironment(),
 	}
 }
 
+// Apply resource limits to every run through a cgroup v2 created under cgroupRoot
+func (r Runtime) WithLimits(cgroupRoot string, limits Limits) Runtime {
+	r.cgroupRoot = cgroupRoot
+	r.limits = limits
+	return r
+}
+
+// Kill every run, that takes longer than timeout, together with all of its processes
+func (r Runtime) WithTimeout(timeout time.Duration) Runtime {
+	r.timeout = timeout
+	return r
+}
+
+// Stop every run, that produces more output than limits allow
+func (r Runtime) WithOutputLimits(limits OutputLimits) Runtime {
+	r.outputLimits = limits
+	return r
+}
+
+// Give the user with uid and gid exclusive access to the run directory
+//
+// Should be the user that runs are executed as, so runtimes of different users cannot access each other's files
+func (r Runtime) WithOwner(uid int, gid int) Runtime {
+	r.owner = &dirOwner{uid: uid, gid: gid}
+	return r
+}
+
+// Start node through the seccomp-exec helper with a profile
+//
+// Scripts, that make a forbidden syscall, are killed and reported with RunResult.SyscallBlocked
+func (r Runtime) WithSeccomp(helper string, profile SeccompProfile) Runtime {
+	r.seccomp = &seccompExec{helper: helper, profile: profile}
+	return r
+}
+
+// Start node with a base environment, which submissions can add to, except for protected variables
+//
+// Node never inherits variables of the runner, without a base environment it starts with none
+func (r Runtime) WithEnvironment(env Environment) Runtime {
+	r.environment = env
+	return r
+}
+
+// Run scripts with a node executable, that was resolved beforehand, e.g. with DetectNode
+func (r Runtime) WithNode(node Node) Runtime {
+	r.node = &node
+	return r
+}
+
+// Pass output of the script to a handler while it runs, in addition to collecting it into RunResult
+//
+// The handler is never called concurrently, and chunks come in order of their numbers.
+// A slow handler slows down the script, once the pipes of its outputs are full
+func (r Runtime) WithOutputHandler(handler func(OutputChunk)) Runtime {
+	r.onOutput = handler
+	return r
+}
+
+// Run a script without any input
+//
 // TODO: add support for extra files, e.g. through variable arguments
 func (r Runtime) Run(ctx context.Context, code string) (*RunResult, error) {
+	return r.RunWithInput(ctx, code, Input{})
+}
+
+// Run a script with stdin and arguments
+func (r Runtime) RunWithInput(ctx context.Context, code string, input Input) (*RunResult, error) {
+	return r.run(ctx, code, input, nil)
+}
+
+// Run a script, with input written while it runs, if it is a session
+func (r Runtime) run(ctx context.Context, code string, input Input, sess *session) (*RunResult, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	env, err := r.environment.merge(input.Env)
+	if err != nil {
+		return nil, err
+	}
+
 	r.lck.Lock()
 	defer r.lck.Unlock()
 
 	if err := prepare(r.root, code); err != nil {
 		return nil, fmt.Errorf("preparing: %w", err)
 	}
-
-	cmd, err := r.env.Login(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("logging in: %w", err)
+	if sess == nil {
+		if err := input.writeStdin(r.root); err != nil {
+			return nil, err
+		}
 	}
-
-	nodePath, err := nodeAbsPath(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("getting node path: %w", err)
+	if err := r.own(); err != nil {
+		return nil, err
 	}
 
-	stdinStr := *nodePath + " " + path.Join(r.root, "index.js")
-	stdin := strings.NewReader(stdinStr)
-	cmd.Stdin = stdin
-	slog.Info("Prepared stdin for shell", slog.String("in", stdinStr))
-
-	// Read all data from outputs, while the command is still running
-	stdout, stderr, err := getOutPipes(cmd)
+	node, err := r.nodeExecutable()
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		// Final buffers to write output to
-		finStdout bytes.Buffer
-		// Final buffers to write output to
-		finStderr bytes.Buffer
-
-		// For parallel reading of outpus during execution
-		readWg sync.WaitGroup
-	)
-
-	slog.Info("Started execution", slog.String("cmd", cmd.String()))
+	program := isolate(env, r.confine(node.Path, "index.js")...)
+	command := input.command(program...)
+	opts := execOptions{onOutput: r.onOutput}
 
-	readWg.Add(1)
-	go func() {
-		defer readWg.Done()
-		b, err := io.ReadAll(stdout)
-		if err != nil {
-			slog.Error("Error reading stdout", slog.String("err", err.Error()))
-		} else {
-			finStdout.Write(b)
-		}
-	}()
-
-	readWg.Add(1)
-	go func() {
-		defer readWg.Done()
-		b, err := io.ReadAll(stderr)
-		if err != nil {
-			slog.Error("Error reading stderr", slog.String("err", err.Error()))
-		} else {
-			finStderr.Write(b)
+	if sess != nil {
+		if err := sess.start(r.root, input.Stdin); err != nil {
+			return nil, fmt.Errorf("starting session: %w", err)
 		}
-	}()
-
-	// Command start time
-	start := time.Now()
+		defer sess.stop()
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("starting shell: %w", err)
+		command = input.commandWithStdin(sessionStdinName, program...)
+		opts.onOutput = sess.onOutput(r.onOutput)
+		opts.idle = sess.idle
 	}
 
-	// Finish reading before comamnd completion, cannot be done other way round
-	readWg.Wait()
-
-	// An error other than exiterror indicates a system error
-	if err := cmd.Wait(); err != nil {
-		exitErr, ok := err.(*exec.ExitError)
-		if ok {
-			slog.Warn("Non-zero exitcode running user code", slog.Int("code", exitErr.ExitCode()))
-		} else {
-			return nil, fmt.Errorf("running cmd: %w", err)
-		}
+	ex, err := r.execute(ctx, "cd "+shellQuote(r.root)+" && "+command, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	res := &RunResult{
-		Stdout:   finStdout.Bytes(),
-		Stderr:   finStderr.Bytes(),
-		ExitCode: cmd.ProcessState.ExitCode(),
-		TimeTook: time.Now().Sub(start),
+		Stdout:   ex.stdout,
+		Stderr:   ex.stderr,
+		ExitCode: ex.exitCode,
+		TimeTook: ex.timeTook,
+
+		StdoutTruncated: ex.stdoutTruncated,
+		StderrTruncated: ex.stderrTruncated,
+
+		TimedOut:       ex.timedOut,
+		LimitHit:       ex.limitHit,
+		CPUThrottled:   ex.cpuThrottled,
+		SyscallBlocked: r.seccomp != nil && ex.killedBySIGSYS,
+		IdleTimedOut:   ex.idleTimedOut,
 	}
 
-	slog.Info("Finished running user code", slog.Any("result", res), slog.Duration("timeTook", time.Now().Sub(start)))
+	slog.Info("Finished running user code", slog.Any("result", res), slog.Duration("timeTook", res.TimeTook))
 
 	return res, nil
 }
 
+// Arguments, that start a program with the seccomp filter, if there is one
+func (r Runtime) confine(program ...string) []string {
+	if r.seccomp == nil {
+		return program
+	}
+	return append([]string{r.seccomp.helper, "-profile", string(r.seccomp.profile), "--"}, program...)
+}
+
 func prepare(dir string, code string) error {
 	if err := clearDirectory(dir); err != nil {
 		return fmt.Errorf("clearing: %w", err)
@@ -154,6 +281,29 @@ func prepare(dir string, code string) error {
 	return nil
 }
 
+// Hand the prepared run directory over to its owner, if there is one
+func (r Runtime) own() error {
+	if r.owner == nil {
+		return nil
+	}
+
+	err := filepath.WalkDir(r.root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, r.owner.uid, r.owner.gid)
+	})
+	if err != nil {
+		return fmt.Errorf("changing owner of %s: %w", r.root, err)
+	}
+
+	if err := os.Chmod(r.root, 0700); err != nil {
+		return fmt.Errorf("restricting access to %s: %w", r.root, err)
+	}
+
+	return nil
+}
+
 // Cleans a directory with all its contents and recreates it with 0777 perms
 func clearDirectory(dir string) error {
 	if err := os.RemoveAll(dir); err != nil {
@@ -165,35 +315,17 @@ func clearDirectory(dir string) error {
 	return nil
 }
 
-// Get output pipes fro a comand (stdout, stderr)
-//
-// Pipesdo usually do not need to be closed manually, as they are autmoatically closed
-// when the comand exits
-func getOutPipes(cmd *exec.Cmd) (io.ReadCloser, io.ReadCloser, error) {
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting stdout: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting stderr: %w", err)
+// Node, that runs scripts of the runtime
+func (r Runtime) nodeExecutable() (Node, error) {
+	if r.node != nil {
+		return *r.node, nil
 	}
 
-	return stdout, stderr, nil
-}
-
-// Finds the absolute path to  go executable
-func nodeAbsPath(ctx context.Context) (*string, error) {
-	cmd := exec.CommandContext(ctx, "which", "node")
-	out, err := cmd.CombinedOutput()
+	node, err := pathNode()
 	if err != nil {
-		slog.Warn("Could not get path of the node executable")
-		return nil, fmt.Errorf("running which node: %w", err)
+		return Node{}, fmt.Errorf("detecting node: %w", err)
 	}
-
-	s := strings.TrimSpace(string(out))
-	return &s, nil
+	return node, nil
 }
 
 func writeMain(root string, code string) error {
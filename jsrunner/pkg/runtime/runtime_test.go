@@ -2,6 +2,12 @@ package runtime
 
 import (
 	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -33,3 +39,387 @@ func TestHelloWorld(t *testing.T) {
 		assert.Equal(t, expect.ExitCode, res.ExitCode, "Should produce same exit code")
 	}
 }
+
+func TestMemoryLimit(t *testing.T) {
+	const cgroupRoot = "/sys/fs/cgroup"
+	if controllers, err := os.ReadFile(cgroupRoot + "/cgroup.controllers"); err != nil || !strings.Contains(string(controllers), "memory") {
+		t.Skip("cgroup v2 memory controller is not available")
+	}
+
+	const code = `const chunks = []
+for (let i = 0; i < 64; i++) {
+	chunks.push(Buffer.alloc(32 * 1024 * 1024, 1))
+}
+console.log(chunks.length)`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithLimits(cgroupRoot+"/jsrunner-test", Limits{Memory: 256 << 20})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, code)
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, LimitMemory, res.LimitHit, "Should report the memory limit")
+		assert.NotEqual(t, 0, res.ExitCode, "Should not exit successfully")
+		assert.Empty(t, res.Stdout, "Should be killed before printing")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	const code = `while (true) {}`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithTimeout(time.Second * 2)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	start := time.Now()
+	res, err := r.Run(ctx, code)
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.TimedOut, "Should be reported as timed out")
+		assert.NotEqual(t, 0, res.ExitCode, "Should not exit successfully")
+		assert.Less(t, time.Since(start), time.Second*5, "Should be killed shortly after the timeout")
+	}
+}
+
+func TestNoStrayProcesses(t *testing.T) {
+	// The background process keeps stdout open, which must not block the run either
+	const code = `const { spawn } = require('child_process')
+const child = spawn('sleep', ['31337'], { detached: false, stdio: ['ignore', 'inherit', 'ignore'] })
+child.unref()
+console.log('started')`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithTimeout(time.Second * 15)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, code)
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "started\n", string(res.Stdout), "Should produce stdout")
+		assert.False(t, res.TimedOut, "Should not wait for the background process")
+	}
+
+	assert.Empty(t, findProcesses(t, "sleep\x0031337"), "Background process should be killed")
+}
+
+// Pids of processes whose command line starts with prefix, arguments are separated by NUL
+func findProcesses(t *testing.T, prefix string) []string {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pids []string
+	for _, file := range cmdlines {
+		cmdline, err := os.ReadFile(file)
+		if err == nil && strings.HasPrefix(string(cmdline), prefix) {
+			pids = append(pids, filepath.Base(filepath.Dir(file)))
+		}
+	}
+
+	return pids
+}
+
+func TestOutputLimit(t *testing.T) {
+	const code = `while (true) { console.log('spam') }`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env).
+			WithTimeout(time.Second * 15).
+			WithOutputLimits(OutputLimits{Stream: 1000, Total: 1500})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, code)
+
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Len(t, res.Stdout, 1000, "Should keep stdout up to the limit")
+		assert.True(t, res.StdoutTruncated, "Should report truncated stdout")
+		assert.False(t, res.StderrTruncated, "Should not report truncated stderr")
+		assert.False(t, res.TimedOut, "Should be stopped before the timeout")
+	}
+}
+
+func TestStdinAndArgs(t *testing.T) {
+	const code = `const input = require('fs').readFileSync(0, 'utf8')
+process.stdout.write(process.argv.slice(2).join(',') + '|' + input)`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		input  Input
+		expect string
+	}{
+		{name: "No input", input: Input{}, expect: "|"},
+		{name: "Stdin", input: Input{Stdin: []byte("line 1\nline 2\n")}, expect: "|line 1\nline 2\n"},
+		{
+			name:   "Shell syntax in args",
+			input:  Input{Args: []string{"$(echo injected)", "; echo injected", "it's", "`id`", "a b"}},
+			expect: "$(echo injected),; echo injected,it's,`id`,a b|",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := r.RunWithInput(ctx, code, test.input)
+			if assert.NoError(t, err, "A system error happened") {
+				assert.Equal(t, test.expect, string(res.Stdout), "Script should get exactly the input")
+				assert.Equal(t, 0, res.ExitCode)
+			}
+		})
+	}
+
+	_, err := r.RunWithInput(ctx, code, Input{Args: []string{"a\x00b"}})
+	assert.ErrorIs(t, err, ErrInvalidSubmission, "Null bytes can not be passed as arguments")
+}
+
+func TestSession(t *testing.T) {
+	const code = `const readline = require('readline')
+console.log('name?')
+const rl = readline.createInterface({ input: process.stdin })
+rl.on('line', (line) => console.log('hello ' + line))
+rl.on('close', () => console.log('bye'))`
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	t.Run("Input after output", func(t *testing.T) {
+		var (
+			stdin  = make(chan []byte)
+			output = make(chan string, 16)
+
+			r = NewRuntime(lck, dir, env).
+				WithSessionLimits(SessionLimits{Idle: 5 * time.Second}).
+				WithOutputHandler(func(chunk OutputChunk) { output <- string(chunk.Data) })
+		)
+
+		// Every line is only sent, once the answer to the previous one was printed
+		go func() {
+			defer close(stdin)
+			for _, line := range []string{"", "gopher", "world"} {
+				if line != "" {
+					stdin <- []byte(line + "\n")
+				}
+				select {
+				case <-output:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		res, err := r.RunSession(ctx, code, Input{}, stdin)
+		if assert.NoError(t, err, "A system error happened") {
+			assert.Equal(t, "name?\nhello gopher\nhello world\nbye\n", string(res.Stdout), "Should read input written while running")
+			assert.Equal(t, 0, res.ExitCode)
+		}
+	})
+
+	t.Run("Idle", func(t *testing.T) {
+		r := NewRuntime(lck, dir, env).WithSessionLimits(SessionLimits{Idle: 500 * time.Millisecond, Total: 10 * time.Second})
+
+		res, err := r.RunSession(ctx, code, Input{}, make(chan []byte))
+		if assert.NoError(t, err, "A system error happened") {
+			assert.True(t, res.IdleTimedOut, "Session without input should be stopped")
+			assert.False(t, res.TimedOut, "Total timeout was not reached")
+		}
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+	const code = `for (const name of Object.keys(process.env).sort()) {
+	console.log(name + '=' + process.env[name])
+}`
+
+	// Must not leak from the runner
+	t.Setenv("MQ_PASS", "secret")
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env).WithEnvironment(Environment{
+			Base:      map[string]string{"PATH": "/usr/bin:/bin", "LANG": "C.UTF-8"},
+			Protected: []string{"PATH", "NODE_*"},
+		})
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.RunWithInput(ctx, code, Input{Env: map[string]string{"TZ": "UTC", "LANG": "en_US.UTF-8"}})
+	if assert.NoError(t, err, "A system error happened") {
+		assert.Equal(t, "LANG=en_US.UTF-8\nPATH=/usr/bin:/bin\nTZ=UTC\n", string(res.Stdout), "Should start with only the base and submitted variables")
+	}
+
+	for _, vars := range []map[string]string{
+		{"PATH": "/tmp"},
+		{"NODE_OPTIONS": "--require /tmp/evil.js"},
+		{"LD_PRELOAD": "/tmp/evil.so"},
+		{"A=B": "x"},
+	} {
+		_, err := r.RunWithInput(ctx, code, Input{Env: vars})
+		assert.ErrorIs(t, err, ErrInvalidSubmission, "%v should be rejected", vars)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	node, err := DetectNode(ctx)
+	if !assert.NoError(t, err, "Node should be found in PATH") {
+		return
+	}
+	assert.Regexp(t, `^v\d+\.`, node.Version, "Should report the version of node")
+	assert.True(t, filepath.IsAbs(node.Path), "Should resolve an absolute path")
+
+	_, err = NewNode(ctx, "/bin/false")
+	assert.Error(t, err, "An executable, that is not node, should be rejected")
+
+	r := NewRuntime(lck, dir, env).WithNode(node)
+	assert.NoError(t, r.SelfTest(ctx), "Should pass with a working node")
+
+	// Found, but not runnable by the program
+	broken := r.WithNode(Node{Path: "/nonexistent/node", Version: node.Version})
+	assert.Error(t, broken.SelfTest(ctx), "Should fail, when node can not be started")
+}
+
+func TestNamespaceEnv(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Creating namespaces requires root")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip is not installed")
+	}
+
+	// A service of the host, that runs should not reach
+	host, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer host.Close()
+
+	code := `const net = require('net')
+const fs = require('fs')
+
+const reachable = (port) => new Promise((resolve) => {
+	const conn = net.connect(port, '127.0.0.1', () => { conn.destroy(); resolve(true) })
+	conn.on('error', () => resolve(false))
+})
+
+const server = net.createServer((conn) => conn.destroy()).listen(0, '127.0.0.1', async () => {
+	console.log('host reachable:', await reachable(` + strconv.Itoa(host.Addr().(*net.TCPAddr).Port) + `))
+	console.log('loopback reachable:', await reachable(server.address().port))
+	server.close()
+
+	const processes = fs.readdirSync('/proc').filter((name) => /^[0-9]+$/.test(name)).length
+	console.log('processes:', processes)
+})`
+
+	var (
+		env = NewNamespaceEnv(userenv.SameUserEnv{})
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	res, err := r.Run(ctx, code)
+	if !assert.NoError(t, err, "A system error happened") {
+		return
+	}
+	if !assert.Equal(t, 0, res.ExitCode, "Stderr: %s", res.Stderr) {
+		return
+	}
+
+	assert.Equal(t, "host reachable: false\nloopback reachable: true\nprocesses: 1\n", string(res.Stdout),
+		"Only loopback of the run and its own processes should be visible")
+}
+
+func TestSeccomp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	// The helper is a part of gorunner
+	helper := filepath.Join(t.TempDir(), "seccomp-exec")
+	build := exec.CommandContext(ctx, "go", "build", "-o", helper, "./cmd/seccomp-exec")
+	build.Dir = "../../../gorunner"
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("Could not build seccomp-exec: %v: %s", err, out)
+	}
+
+	var (
+		env = userenv.SameUserEnv{}
+		lck = &sync.Mutex{}
+		dir = "/tmp/jsrunner/test/"
+
+		r = NewRuntime(lck, dir, env)
+	)
+
+	res, err := r.WithSeccomp(helper, SeccompStrict).Run(ctx, `console.log(require('fs').readFileSync('index.js', 'utf8').length)`)
+	if assert.NoError(t, err, "A system error happened") {
+		assert.False(t, res.SyscallBlocked, "Stderr: %s", res.Stderr)
+		assert.Equal(t, "66\n", string(res.Stdout), "Scripts, that only work with files, should be allowed")
+	}
+
+	res, err = r.WithSeccomp(helper, SeccompStrict).Run(ctx, `console.log('before'); require('net').connect(80, '127.0.0.1')`)
+	if assert.NoError(t, err, "A system error happened") {
+		assert.True(t, res.SyscallBlocked, "Should report the blocked socket")
+		assert.Equal(t, "before\n", string(res.Stdout))
+	}
+}
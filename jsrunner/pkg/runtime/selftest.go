@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+)
+
+// Script of the self test, it prints its only argument
+const selfTestCode = `console.log(process.argv[2])`
+
+const selfTestOutput = "jsrunner self test"
+
+// Run a smoke script the way submissions are run, checking that the environment can execute anything at all
+//
+// Meant to be called once at startup, so that a broken user, directory or limit is noticed before the first submission
+func (r Runtime) SelfTest(ctx context.Context) error {
+	res, err := r.RunWithInput(ctx, selfTestCode, Input{Args: []string{selfTestOutput}})
+	if err != nil {
+		return fmt.Errorf("running smoke script: %w", err)
+	}
+
+	if res.ExitCode != 0 || string(res.Stdout) != selfTestOutput+"\n" {
+		return fmt.Errorf("smoke script exited with %d, stdout: %q, stderr: %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	return nil
+}